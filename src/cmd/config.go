@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/ovh/jerem/src/core"
+	"github.com/ovh/jerem/src/runner"
+)
+
+func init() {
+	configCmd.AddCommand(validateCmd)
+	RootCmd.AddCommand(configCmd)
+}
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Manage jerem config",
+}
+
+var validateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Validate the config, checking projects, boards, JQL filters, fields and statuses on Jira",
+	Run: func(cmd *cobra.Command, args []string) {
+		config, err := core.LoadConfig()
+		if err != nil {
+			log.WithError(err).Fatal("Invalid config")
+		}
+
+		reports, err := runner.ValidateConfig(config)
+		if err != nil {
+			log.WithError(err).Fatal("Fail to validate config")
+		}
+
+		failed := false
+		for _, report := range reports {
+			status := "OK"
+			if report.Failed() {
+				status = "ERROR"
+				failed = true
+			}
+			fmt.Printf("%s: %s\n", report.Name, status)
+
+			for _, check := range report.Checks {
+				if check.Err != nil {
+					fmt.Printf("  [ERROR] %s: %s\n", check.Name, check.Err)
+				} else {
+					fmt.Printf("  [OK]    %s\n", check.Name)
+				}
+			}
+		}
+
+		if failed {
+			log.Fatal("Config is invalid")
+		}
+	},
+}
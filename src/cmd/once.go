@@ -0,0 +1,100 @@
+package cmd
+
+import (
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/ovh/jerem/src/core"
+	"github.com/ovh/jerem/src/runner"
+)
+
+var (
+	onlyRunner  string
+	onlyProject string
+)
+
+func init() {
+	onceCmd.Flags().StringVar(&onlyRunner, "only", "", "only run the given collector (epic, sprint, board or flow)")
+	onceCmd.Flags().StringVar(&onlyProject, "project", "", "only collect the project with the given name or label")
+
+	RootCmd.AddCommand(onceCmd)
+}
+
+var onceCmd = &cobra.Command{
+	Use:   "once",
+	Short: "Run the collectors once, push the metrics and exit",
+	Run: func(cmd *cobra.Command, args []string) {
+		if onlyRunner != "" && onlyRunner != "epic" && onlyRunner != "sprint" && onlyRunner != "board" && onlyRunner != "flow" {
+			log.Fatalf("Unknown collector '%s', expected epic, sprint, board or flow", onlyRunner)
+		}
+
+		config, err := core.LoadConfig()
+		if err != nil {
+			log.WithError(err).Fatal("Fail to load config")
+		}
+
+		config, err = runner.ResolveFields(config)
+		if err != nil {
+			log.WithError(err).Fatal("Fail to resolve jira fields")
+		}
+
+		if onlyProject != "" {
+			config.Projects, err = filterProjects(config.Projects, onlyProject)
+			if err != nil {
+				log.WithError(err).Fatal("Fail to select project")
+			}
+			config.Partial = true
+		}
+
+		sinks, err := core.NewSinks(config)
+		if err != nil {
+			log.WithError(err).Fatal("Fail to create metrics sinks")
+		}
+
+		failed := false
+		if onlyRunner == "" || onlyRunner == "epic" {
+			if err := runner.EpicRunner(config, sinks); err != nil {
+				log.WithError(err).Error("Epic collection failed")
+				failed = true
+			}
+		}
+		if onlyRunner == "" || onlyRunner == "sprint" {
+			if err := runner.SprintRunner(config, sinks); err != nil {
+				log.WithError(err).Error("Sprint collection failed")
+				failed = true
+			}
+		}
+		if onlyRunner == "" || onlyRunner == "board" {
+			if err := runner.BoardRunner(config, sinks); err != nil {
+				log.WithError(err).Error("Board collection failed")
+				failed = true
+			}
+		}
+		if onlyRunner == "" || onlyRunner == "flow" {
+			if err := runner.FlowRunner(config, sinks); err != nil {
+				log.WithError(err).Error("Flow collection failed")
+				failed = true
+			}
+		}
+
+		if failed {
+			log.Fatal("Collection failed")
+		}
+	},
+}
+
+func filterProjects(projects []core.Project, name string) ([]core.Project, error) {
+	var res []core.Project
+	for _, project := range projects {
+		if project.Name == name || project.Label == name {
+			res = append(res, project)
+		}
+	}
+
+	if len(res) == 0 {
+		return nil, fmt.Errorf("project '%s' is not configured", name)
+	}
+	return res, nil
+}
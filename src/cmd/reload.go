@@ -0,0 +1,167 @@
+package cmd
+
+import (
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"sync"
+	"syscall"
+
+	"github.com/fsnotify/fsnotify"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+
+	"github.com/ovh/jerem/src/core"
+	"github.com/ovh/jerem/src/runner"
+)
+
+// reloadMutex serialize the reloads, viper isn't safe for concurrent use
+var reloadMutex sync.Mutex
+
+// startupSettings hold the settings only read at startup, outside of the
+// config store, to refuse a reload changing them
+var startupSettings map[string]string
+
+// getStartupSettings return the viper settings only read at startup
+func getStartupSettings() map[string]string {
+	return map[string]string{
+		"api.listen":    viper.GetString("api.listen"),
+		"runner.period": viper.GetDuration("runner.period").String(),
+	}
+}
+
+// watchConfig reload the config when the config file change or on SIGHUP.
+// Both triggers are funneled through a single reload goroutine, and the
+// triggers received during a reload are coalesced into the next one
+func watchConfig(store *core.ConfigStore) {
+	reloadMutex.Lock()
+	startupSettings = getStartupSettings()
+	reloadMutex.Unlock()
+
+	triggers := make(chan string, 1)
+
+	if path := viper.ConfigFileUsed(); path != "" {
+		if err := watchFile(path, triggers); err != nil {
+			log.WithField("file", path).WithError(err).Warn("Fail to watch config file")
+		}
+	}
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			trigger(triggers, "SIGHUP received")
+		}
+	}()
+
+	go func() {
+		for reason := range triggers {
+			log.Info(reason)
+			reloadConfig(store)
+		}
+	}()
+}
+
+// watchFile trigger a reload when the config file is written or replaced.
+// Its directory is watched to follow the editors and kubernetes config maps
+// replacing the file instead of writing it
+func watchFile(path string, triggers chan<- string) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+
+	path = filepath.Clean(path)
+	if err := watcher.Add(filepath.Dir(path)); err != nil {
+		watcher.Close()
+		return err
+	}
+	realPath, _ := filepath.EvalSymlinks(path)
+
+	go func() {
+		defer watcher.Close()
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+
+				current, _ := filepath.EvalSymlinks(path)
+				written := filepath.Clean(event.Name) == path && event.Op&(fsnotify.Write|fsnotify.Create) != 0
+				replaced := current != "" && current != realPath
+				if written || replaced {
+					realPath = current
+					trigger(triggers, "Config file changed")
+				}
+
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				log.WithField("file", path).WithError(err).Warn("Config watcher error")
+			}
+		}
+	}()
+	return nil
+}
+
+// trigger queue a reload unless one is already queued
+func trigger(triggers chan<- string, reason string) {
+	select {
+	case triggers <- reason:
+	default:
+	}
+}
+
+// reloadConfig load the config again and make it active for the next runs.
+// An invalid config, or one changing the settings only read at startup like
+// the metrics sinks, is refused and the active one is kept
+func reloadConfig(store *core.ConfigStore) {
+	reloadMutex.Lock()
+	defer reloadMutex.Unlock()
+
+	config, err := readConfig()
+	if err != nil {
+		log.WithError(err).Error("Invalid config, keeping the active one")
+		return
+	}
+
+	changes := core.RestartChanges(store.Get(), config)
+	for key, value := range getStartupSettings() {
+		if startupSettings[key] != value {
+			changes = append(changes, key)
+		}
+	}
+	if len(changes) > 0 {
+		sort.Strings(changes)
+		log.WithField("settings", changes).Error("Config changes require a restart, keeping the active one")
+		return
+	}
+
+	previous := store.Swap(config)
+	diff := core.DiffProjects(previous.Projects, config.Projects)
+	log.WithFields(log.Fields{
+		"added":   diff.Added,
+		"removed": diff.Removed,
+		"changed": diff.Changed,
+	}).Info("Config reloaded")
+}
+
+func readConfig() (core.Config, error) {
+	if viper.ConfigFileUsed() != "" {
+		if err := viper.ReadInConfig(); err != nil {
+			return core.Config{}, err
+		}
+		if err := core.ExpandConfigEnv(); err != nil {
+			return core.Config{}, err
+		}
+	}
+
+	config, err := core.LoadConfig()
+	if err != nil {
+		return core.Config{}, err
+	}
+	return runner.ResolveFields(config)
+}
@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ovh/jerem/src/core"
+)
+
+const reloadConfigFile = `
+jira:
+  username: jerem
+  password: foo
+  url: https://jira.com
+metrics:
+  url: https://warp.io
+  token: bar
+projects:
+  - name: K8S
+    board: 96
+    epic_children: parent`
+
+// waitProjects wait until the active config has the given number of projects
+func waitProjects(store *core.ConfigStore, count int) bool {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if len(store.Get().Projects) == count {
+			return true
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return false
+}
+
+func TestWatchConfig(t *testing.T) {
+	assert := require.New(t)
+
+	dir, err := ioutil.TempDir("", "jerem")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "config.yml")
+	assert.NoError(ioutil.WriteFile(path, []byte(reloadConfigFile), 0644))
+
+	viper.SetConfigFile(path)
+	defer viper.SetConfigFile("")
+
+	config, err := readConfig()
+	assert.NoError(err)
+	store := core.NewConfigStore(config)
+	watchConfig(store)
+
+	// A file change reload the config
+	assert.NoError(ioutil.WriteFile(path, []byte(reloadConfigFile+`
+  - name: OB
+    board: 12
+    epic_children: parent`), 0644))
+	assert.True(waitProjects(store, 2))
+
+	// A SIGHUP reload the config, even during a file change
+	assert.NoError(ioutil.WriteFile(path, []byte(reloadConfigFile), 0644))
+	assert.NoError(syscall.Kill(os.Getpid(), syscall.SIGHUP))
+	assert.True(waitProjects(store, 1))
+
+	// Settings only read at startup can't be reloaded
+	assert.NoError(ioutil.WriteFile(path, []byte(strings.Replace(reloadConfigFile+`
+  - name: OB
+    board: 12
+    epic_children: parent`, "https://warp.io", "https://warp.example.com", 1)), 0644))
+	assert.NoError(syscall.Kill(os.Getpid(), syscall.SIGHUP))
+	time.Sleep(100 * time.Millisecond)
+	assert.Len(store.Get().Projects, 1)
+	assert.Equal("https://warp.io", store.Get().Metrics[0].URL)
+
+	assert.NoError(ioutil.WriteFile(path, []byte(reloadConfigFile+`
+dryrun:
+  enabled: true`), 0644))
+	assert.NoError(syscall.Kill(os.Getpid(), syscall.SIGHUP))
+	time.Sleep(100 * time.Millisecond)
+	assert.False(store.Get().DryRun.Enabled)
+
+	// An invalid config is refused
+	assert.NoError(ioutil.WriteFile(path, []byte("jira: ["), 0644))
+	assert.NoError(syscall.Kill(os.Getpid(), syscall.SIGHUP))
+	time.Sleep(100 * time.Millisecond)
+	assert.Len(store.Get().Projects, 1)
+}
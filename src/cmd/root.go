@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"bytes"
 	"fmt"
 	"net/http"
 	"os"
@@ -27,11 +28,25 @@ func init() {
 
 	RootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is ./config.yml)")
 	RootCmd.PersistentFlags().Int32("log-level", 4, "set logging level between 0 and 6")
+	RootCmd.PersistentFlags().Bool("dry-run", false, "print the metrics instead of pushing them")
+	RootCmd.PersistentFlags().String("dry-run-format", core.FormatGTS, "dry run output format (gts or json)")
+	RootCmd.PersistentFlags().String("dry-run-output", "", "dry run output file (default is stdout)")
 
 	// Bind persistent / local flags from cobra to viper
 	if err := viper.BindPFlags(RootCmd.PersistentFlags()); err != nil {
 		log.Fatal(err)
 	}
+
+	// Dry run flags override the dryrun config keys
+	for key, flag := range map[string]string{
+		"dryrun.enabled": "dry-run",
+		"dryrun.format":  "dry-run-format",
+		"dryrun.path":    "dry-run-output",
+	} {
+		if err := viper.BindPFlag(key, RootCmd.PersistentFlags().Lookup(flag)); err != nil {
+			log.Fatal(err)
+		}
+	}
 }
 
 func initConfig() {
@@ -56,7 +71,16 @@ func initConfig() {
 	viper.AutomaticEnv()
 
 	if err := viper.ReadInConfig(); err == nil {
-		fmt.Println("Using config file:", viper.ConfigFileUsed())
+		// Dry run metrics may be printed on stdout, keep it clean
+		out := os.Stdout
+		if viper.GetBool("dryrun.enabled") {
+			out = os.Stderr
+		}
+		fmt.Fprintln(out, "Using config file:", viper.ConfigFileUsed())
+
+		if err := core.ExpandConfigEnv(); err != nil {
+			log.WithError(err).Fatal("Fail to read config file")
+		}
 	}
 
 	level := viper.GetInt("log-level")
@@ -68,14 +92,33 @@ func initConfig() {
 
 // RootCmd main command of jerem
 var RootCmd = &cobra.Command{
-	Use:   "jerem",
-	Short: "Jerem bring observability to Jira",
+	Use:     "jerem",
+	Short:   "Jerem bring observability to Jira",
+	Version: core.Version,
 	Run: func(cmd *cobra.Command, args []string) {
 		config, err := core.LoadConfig()
 		if err != nil {
 			log.WithError(err).Fatal("Fail to load config")
 		}
 
+		config, err = runner.ResolveFields(config)
+		if err != nil {
+			log.WithError(err).Fatal("Fail to resolve jira fields")
+		}
+		log.WithField("config", fmt.Sprintf("%+v", config)).Debug("Config loaded")
+
+		sinks, err := core.NewSinks(config)
+		if err != nil {
+			log.WithError(err).Fatal("Fail to create metrics sinks")
+		}
+
+		var exporter *core.PrometheusExporter
+		if config.Prometheus.Enabled {
+			exporter = core.NewPrometheusExporter()
+			sinks = append(sinks, exporter)
+		}
+		log.WithField("sinks", sinks.Name()).Info("Metrics sinks ready")
+
 		// Jerem status handler
 		go func() {
 			e := echo.New()
@@ -84,6 +127,24 @@ var RootCmd = &cobra.Command{
 			e.GET("/health", func(c echo.Context) error {
 				return c.NoContent(http.StatusOK)
 			})
+			e.GET("/status", func(c echo.Context) error {
+				return c.JSON(http.StatusOK, map[string]interface{}{
+					"spool": core.SpoolDepths(sinks),
+				})
+			})
+			if exporter != nil {
+				e.GET("/metrics", func(c echo.Context) error {
+					openMetrics := strings.Contains(c.Request().Header.Get(echo.HeaderAccept), "application/openmetrics-text")
+					contentType := core.PrometheusContentType
+					if openMetrics {
+						contentType = core.OpenMetricsContentType
+					}
+
+					var b bytes.Buffer
+					exporter.Render(&b, openMetrics)
+					return c.Blob(http.StatusOK, contentType, b.Bytes())
+				})
+			}
 
 			err := e.Start(address)
 			if err != nil && err != http.ErrServerClosed {
@@ -91,13 +152,34 @@ var RootCmd = &cobra.Command{
 			}
 		}()
 
-		// Start Jerem JIRA epic and sprint collectors
+		// Runners read the active config at each run, so a reloaded config
+		// is used from the next run
+		store := core.NewConfigStore(config)
+		watchConfig(store)
+
+		// Start Jerem JIRA epic, sprint, board and flow collectors
 		epicRunner := core.NewRunner(func() {
-			runner.EpicRunner(config)
+			if err := runner.EpicRunner(store.Get(), sinks); err != nil {
+				log.WithError(err).Warn("Epic collection is incomplete")
+			}
 		}, viper.GetDuration("runner.period")+1*time.Second)
 
 		sprintRunner := core.NewRunner(func() {
-			runner.SprintRunner(config)
+			if err := runner.SprintRunner(store.Get(), sinks); err != nil {
+				log.WithError(err).Warn("Sprint collection is incomplete")
+			}
+		}, viper.GetDuration("runner.period"))
+
+		boardRunner := core.NewRunner(func() {
+			if err := runner.BoardRunner(store.Get(), sinks); err != nil {
+				log.WithError(err).Warn("Board collection is incomplete")
+			}
+		}, viper.GetDuration("runner.period"))
+
+		flowRunner := core.NewRunner(func() {
+			if err := runner.FlowRunner(store.Get(), sinks); err != nil {
+				log.WithError(err).Warn("Flow collection is incomplete")
+			}
 		}, viper.GetDuration("runner.period"))
 
 		var gracefulStop = make(chan os.Signal, 1)
@@ -108,5 +190,7 @@ var RootCmd = &cobra.Command{
 
 		epicRunner.Stop()
 		sprintRunner.Stop()
+		boardRunner.Stop()
+		flowRunner.Stop()
 	},
 }
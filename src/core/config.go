@@ -2,38 +2,231 @@ package core
 
 import (
 	"fmt"
+	"regexp"
 	"strings"
+	"time"
 
 	"github.com/spf13/viper"
 )
 
 // Config is jerem root config
 type Config struct {
-	Projects []Project
-	Jira     Jira
-	Metrics  Metrics
+	Projects   []Project
+	Jira       Jira
+	Metrics    []Metrics
+	Prometheus Prometheus
+	Spool      Spool
+	DryRun     DryRun
+	Flow       Flow
+	Board      Board
+	Velocity   Velocity
+	Burndown   Burndown
+	Periods    Periods
+	Dimensions []Dimension
+
+	Concurrency int
+
+	// Partial is set when only some of the configured projects are
+	// collected, the series summed across projects are then skipped
+	Partial bool
 }
 
 // Project define a jira project
 type Project struct {
-	Name  string
-	Board int
-	Jql   string
-	Label string
+	Name    string
+	Board   int
+	Jql     string
+	Label   string
+	Fields  Fields
+	Mode    string
+	Periods Periods
+
+	EpicChildren    string
+	EpicChildrenJql string
 }
 
+// Epic children lookup strategies, auto use parent on Jira Cloud and the
+// Epic Link field on Jira Server
+const (
+	EpicChildrenAuto     = "auto"
+	EpicChildrenEpicLink = "epiclink"
+	EpicChildrenParent   = "parent"
+	EpicChildrenJql      = "jql"
+)
+
+// EpicKeyPlaceholder is replaced by the epic key in the epic children JQL
+const EpicKeyPlaceholder = "{key}"
+
+// Project modes, an empty mode is detected from the board type
+const (
+	ModeScrum  = "scrum"
+	ModeKanban = "kanban"
+)
+
 // Jira define jira params
 type Jira struct {
 	Username       string
-	Password       string
+	Password       Secret
 	URL            string
 	ClosedStatuses []string
+	Fields         Fields
+	Auth           Auth
+	RateLimit      float64
+	Timeout        time.Duration
+	Retry          Retry
 }
 
-// Metrics define metrics params
+// Retry define the retries of the jira requests failing with a 429 or 5xx
+// status or a transport error. The delay between attempts doubles from
+// Backoff up to MaxBackoff, unless jira sets a Retry-After header
+type Retry struct {
+	Max        int
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+// Jira auth types
+const (
+	AuthBasic  = "basic"
+	AuthBearer = "bearer"
+	AuthOAuth1 = "oauth1"
+)
+
+// Auth define jira authentication params, username and password are used
+// by the basic auth
+type Auth struct {
+	Type        string
+	Token       Secret
+	ConsumerKey string
+	PrivateKey  string
+}
+
+// Fields define the jira custom fields read by jerem, either by id or by
+// display name until resolved. Initiatives are only collected when the
+// epics parent link field is set. The Epic Link field isn't configured, it
+// is resolved for the projects using the epiclink strategy
+type Fields struct {
+	StoryPoint string
+	Impediment string
+	ParentLink string
+	EpicLink   string
+}
+
+// ParentField is the jira system field holding the parent of an epic on
+// Jira Cloud
+const ParentField = "parent"
+
+// Default custom fields
+const (
+	DefaultStoryPointField = "customfield_10006"
+	DefaultImpedimentField = "customfield_11028"
+)
+
+// Default collection params, the number of projects collected at once and
+// the jira requests per second
+const (
+	DefaultConcurrency = 4
+	DefaultRateLimit   = 10
+)
+
+// Default jira requests timeout and retries
+const (
+	DefaultTimeout    = 30 * time.Second
+	DefaultRetries    = 3
+	DefaultBackoff    = time.Second
+	DefaultMaxBackoff = 30 * time.Second
+)
+
+// Metrics types
+const (
+	MetricsWarp10   = "warp10"
+	MetricsFile     = "file"
+	MetricsStdout   = "stdout"
+	MetricsInfluxDB = "influxdb"
+	MetricsOTLP     = "otlp"
+)
+
+// Output formats of the file and stdout metrics
+const (
+	FormatGTS  = "gts"
+	FormatJSON = "json"
+)
+
+// Metrics define a metrics output params
 type Metrics struct {
-	Token string
-	URL   string
+	Type           string
+	Token          Secret
+	URL            string
+	Path           string
+	Format         string
+	Org            string
+	Bucket         string
+	Headers        map[string]Secret
+	ResourceLabels []string
+}
+
+// Prometheus define prometheus exposition params
+type Prometheus struct {
+	Enabled bool
+}
+
+// Spool define failed metrics spool params
+type Spool struct {
+	Path       string
+	MaxSize    int64
+	MaxAge     time.Duration
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+// DryRun define dry run params, metrics are then printed instead of pushed
+type DryRun struct {
+	Enabled bool
+	Format  string
+	Path    string
+}
+
+// Flow define flow metrics params, computed from the issues changelog
+type Flow struct {
+	Enabled bool
+	Window  time.Duration
+}
+
+// Board define the cumulative flow diagram params, the board snapshots read
+// every board issue
+type Board struct {
+	Enabled bool
+}
+
+// Velocity define the velocity history params, Sprints is the number of
+// closed sprints walked and Average the number of sprints of the rolling
+// average
+type Velocity struct {
+	Sprints int
+	Average int
+}
+
+// Burndown define the sprint burndown params, the ideal burndown is flat
+// on non working week days and holidays
+type Burndown struct {
+	NonWorkingDays []time.Weekday
+	Holidays       []time.Time
+}
+
+// IsWorkingDay return true when the day is neither a non working week day
+// nor a holiday
+func (b Burndown) IsWorkingDay(day time.Time) bool {
+	for _, weekday := range b.NonWorkingDays {
+		if day.Weekday() == weekday {
+			return false
+		}
+	}
+	for _, holiday := range b.Holidays {
+		if holiday.Year() == day.Year() && holiday.YearDay() == day.YearDay() {
+			return false
+		}
+	}
+	return true
 }
 
 // LoadConfig read config from viper
@@ -46,13 +239,69 @@ func LoadConfig() (Config, error) {
 	}
 	config.Jira = jira
 
-	metrics, err := loadMetrics()
+	config.Prometheus = loadPrometheus()
+
+	dryRun, err := loadDryRun()
+	if err != nil {
+		return config, err
+	}
+	config.DryRun = dryRun
+
+	metrics, err := loadMetrics(config.Prometheus.Enabled || config.DryRun.Enabled)
 	if err != nil {
 		return config, err
 	}
 	config.Metrics = metrics
 
-	projects, err := loadProjects()
+	spool, err := loadSpool()
+	if err != nil {
+		return config, err
+	}
+	config.Spool = spool
+
+	concurrency, err := loadConcurrency()
+	if err != nil {
+		return config, err
+	}
+	config.Concurrency = concurrency
+
+	flow, err := loadFlow()
+	if err != nil {
+		return config, err
+	}
+	config.Flow = flow
+
+	config.Board = Board{Enabled: viper.GetBool("board.enabled")}
+
+	velocity, err := loadVelocity()
+	if err != nil {
+		return config, err
+	}
+	config.Velocity = velocity
+
+	burndown, err := loadBurndown()
+	if err != nil {
+		return config, err
+	}
+	config.Burndown = burndown
+
+	periods, err := loadPeriods(viper.GetStringMap("periods"), Periods{
+		Patterns: []*regexp.Regexp{regexp.MustCompile(DefaultPeriodPattern)},
+		Fallback: PeriodFallbackNone,
+		Unit:     PeriodQuarter,
+	}, "global")
+	if err != nil {
+		return config, err
+	}
+	config.Periods = periods
+
+	dimensions, err := loadDimensions()
+	if err != nil {
+		return config, err
+	}
+	config.Dimensions = dimensions
+
+	projects, err := loadProjects(config.Jira.Fields, config.Periods)
 	if err != nil {
 		return config, err
 	}
@@ -61,7 +310,7 @@ func LoadConfig() (Config, error) {
 	return config, nil
 }
 
-func loadProjects() ([]Project, error) {
+func loadProjects(fields Fields, periods Periods) ([]Project, error) {
 	if !viper.IsSet("projects") {
 		return nil, fmt.Errorf("projects is required")
 	}
@@ -114,7 +363,66 @@ func loadProjects() ([]Project, error) {
 			}
 		}
 		label = strings.TrimSpace(label)
-		res = append(res, Project{Name: name, Board: board, Jql: jql, Label: label})
+
+		// Project fields override the jira ones
+		projectFields := fields
+		if _, ok = project["fields"]; ok {
+			overrides, ok := toStringMap(project["fields"])
+			if !ok {
+				return nil, fmt.Errorf("project %d fields should be a map", idx)
+			}
+			projectFields = loadFields(overrides, fields)
+		}
+
+		// Project periods override the global ones
+		projectPeriods := periods
+		if _, ok = project["periods"]; ok {
+			overrides, ok := toStringMap(project["periods"])
+			if !ok {
+				return nil, fmt.Errorf("project %d periods should be a map", idx)
+			}
+			var err error
+			projectPeriods, err = loadPeriods(overrides, periods, fmt.Sprintf("project %d", idx))
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		mode := ""
+		if _, ok = project["mode"]; ok {
+			mode, ok = project["mode"].(string)
+			if !ok || (mode != ModeScrum && mode != ModeKanban) {
+				return nil, fmt.Errorf("project %d mode should be %s or %s", idx, ModeScrum, ModeKanban)
+			}
+		}
+
+		epicChildren := EpicChildrenAuto
+		if _, ok = project["epic_children"]; ok {
+			epicChildren, ok = project["epic_children"].(string)
+			if !ok || (epicChildren != EpicChildrenAuto && epicChildren != EpicChildrenEpicLink && epicChildren != EpicChildrenParent && epicChildren != EpicChildrenJql) {
+				return nil, fmt.Errorf("project %d epic children should be %s, %s, %s or %s", idx, EpicChildrenAuto, EpicChildrenEpicLink, EpicChildrenParent, EpicChildrenJql)
+			}
+		}
+
+		epicChildrenJql := ""
+		if epicChildren == EpicChildrenJql {
+			epicChildrenJql, ok = project["epic_children_jql"].(string)
+			if !ok || !strings.Contains(epicChildrenJql, EpicKeyPlaceholder) {
+				return nil, fmt.Errorf("project %d epic children jql is required and should contain %s", idx, EpicKeyPlaceholder)
+			}
+		}
+
+		res = append(res, Project{
+			Name:            name,
+			Board:           board,
+			Jql:             jql,
+			Label:           label,
+			Fields:          projectFields,
+			Mode:            mode,
+			Periods:         projectPeriods,
+			EpicChildren:    epicChildren,
+			EpicChildrenJql: epicChildrenJql,
+		})
 	}
 
 	return res, nil
@@ -126,42 +434,470 @@ func loadJira() (Jira, error) {
 		return jira, fmt.Errorf("jira is required")
 	}
 
-	if !viper.IsSet("jira.username") {
-		return jira, fmt.Errorf("jira username is required")
+	auth, err := loadAuth()
+	if err != nil {
+		return jira, err
 	}
-	jira.Username = viper.GetString("jira.username")
+	jira.Auth = auth
+
+	if auth.Type == AuthBasic {
+		if !viper.IsSet("jira.username") {
+			return jira, fmt.Errorf("jira username is required")
+		}
+		jira.Username = viper.GetString("jira.username")
 
-	if !viper.IsSet("jira.password") {
-		return jira, fmt.Errorf("jira password is required")
+		jira.Password, err = loadSecret("jira.password")
+		if err != nil {
+			return jira, err
+		}
 	}
-	jira.Password = viper.GetString("jira.password")
 
 	if !viper.IsSet("jira.url") {
 		return jira, fmt.Errorf("jira url is required")
 	}
 	jira.URL = viper.GetString("jira.url")
 
-	viper.SetDefault("jira.closed.statuses", []string{"Resolved", "Closed", "Done"})
+	jira.ClosedStatuses = []string{"Resolved", "Closed", "Done"}
+	if viper.IsSet("jira.closed.statuses") {
+		jira.ClosedStatuses = viper.GetStringSlice("jira.closed.statuses")
+	}
+
+	jira.Fields = loadFields(viper.GetStringMap("jira.fields"), Fields{
+		StoryPoint: DefaultStoryPointField,
+		Impediment: DefaultImpedimentField,
+	})
 
-	jira.ClosedStatuses = viper.GetStringSlice("jira.closed.statuses")
+	// Requests per second shared by all the runners, 0 disable the limit
+	jira.RateLimit = DefaultRateLimit
+	if viper.IsSet("jira.rate_limit") {
+		jira.RateLimit = viper.GetFloat64("jira.rate_limit")
+	}
+	if jira.RateLimit < 0 {
+		return jira, fmt.Errorf("jira rate limit should be positive")
+	}
+
+	jira.Timeout = DefaultTimeout
+	if viper.IsSet("jira.timeout") {
+		jira.Timeout = viper.GetDuration("jira.timeout")
+	}
+	if jira.Timeout <= 0 {
+		return jira, fmt.Errorf("jira timeout should be strictly positive")
+	}
+
+	jira.Retry, err = loadRetry()
+	if err != nil {
+		return jira, err
+	}
 	return jira, nil
 }
 
-func loadMetrics() (Metrics, error) {
-	metrics := Metrics{}
+// loadRetry read the jira requests retries, 0 retries disable them
+func loadRetry() (Retry, error) {
+	retry := Retry{
+		Max:        DefaultRetries,
+		Backoff:    DefaultBackoff,
+		MaxBackoff: DefaultMaxBackoff,
+	}
+
+	if viper.IsSet("jira.retry.max") {
+		retry.Max = viper.GetInt("jira.retry.max")
+	}
+	if viper.IsSet("jira.retry.backoff") {
+		retry.Backoff = viper.GetDuration("jira.retry.backoff")
+	}
+	if viper.IsSet("jira.retry.max_backoff") {
+		retry.MaxBackoff = viper.GetDuration("jira.retry.max_backoff")
+	}
+
+	if retry.Max < 0 {
+		return retry, fmt.Errorf("jira retry max should be positive")
+	}
+	if retry.Backoff <= 0 {
+		return retry, fmt.Errorf("jira retry backoff should be strictly positive")
+	}
+	if retry.MaxBackoff < retry.Backoff {
+		return retry, fmt.Errorf("jira retry max backoff should be greater than the backoff")
+	}
+
+	return retry, nil
+}
+
+// loadAuth read the jira auth params, default to the basic auth
+func loadAuth() (Auth, error) {
+	auth := Auth{Type: AuthBasic}
+	if viper.IsSet("jira.auth.type") {
+		auth.Type = viper.GetString("jira.auth.type")
+	}
+
+	switch auth.Type {
+	case AuthBasic:
+
+	case AuthBearer:
+		token, err := loadSecret("jira.auth.token")
+		if err != nil {
+			return auth, err
+		}
+		auth.Token = token
+
+	case AuthOAuth1:
+		for _, key := range []string{"consumer_key", "private_key"} {
+			if !viper.IsSet(fmt.Sprintf("jira.auth.%s", key)) {
+				return auth, fmt.Errorf("jira auth %s is required", strings.Replace(key, "_", " ", -1))
+			}
+		}
+		auth.ConsumerKey = viper.GetString("jira.auth.consumer_key")
+		auth.PrivateKey = viper.GetString("jira.auth.private_key")
+
+		token, err := loadSecret("jira.auth.token")
+		if err != nil {
+			return auth, err
+		}
+		auth.Token = token
+
+	default:
+		return auth, fmt.Errorf("jira auth type '%s' is unknown", auth.Type)
+	}
+
+	return auth, nil
+}
+
+// loadFields override the default fields with the configured ones
+func loadFields(fields map[string]interface{}, defaults Fields) Fields {
+	res := defaults
+	if storyPoint, ok := fields["storypoint"]; ok {
+		res.StoryPoint = strings.TrimSpace(fmt.Sprintf("%v", storyPoint))
+	}
+	if impediment, ok := fields["impediment"]; ok {
+		res.Impediment = strings.TrimSpace(fmt.Sprintf("%v", impediment))
+	}
+	if parentLink, ok := fields["parentlink"]; ok {
+		res.ParentLink = strings.TrimSpace(fmt.Sprintf("%v", parentLink))
+	}
+	return res
+}
+
+// loadMetrics read the metrics outputs, either a single Warp 10 output
+// or a list of outputs. They are only optional when metrics are exposed
+// through prometheus or in dry run
+func loadMetrics(optional bool) ([]Metrics, error) {
 	if !viper.IsSet("metrics") {
-		return metrics, fmt.Errorf("metrics is required")
+		if optional {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("metrics is required")
 	}
 
-	if !viper.IsSet("metrics.token") {
-		return metrics, fmt.Errorf("metrics token is required")
+	settings := viper.AllSettings()
+
+	outputs, ok := settings["metrics"].([]interface{})
+	if !ok {
+		output, ok := toStringMap(settings["metrics"])
+		if !ok {
+			return nil, fmt.Errorf("metrics should be a map or an array")
+		}
+
+		metrics, err := loadMetricsOutput(output, "metrics")
+		if err != nil {
+			return nil, err
+		}
+		return []Metrics{metrics}, nil
+	}
+
+	if len(outputs) == 0 && !optional {
+		return nil, fmt.Errorf("metrics is required")
+	}
+
+	var res []Metrics
+	for idx, o := range outputs {
+		output, ok := toStringMap(o)
+		if !ok {
+			return nil, fmt.Errorf("metrics %d should be a map", idx)
+		}
+
+		metrics, err := loadMetricsOutput(output, fmt.Sprintf("metrics %d", idx))
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, metrics)
 	}
-	metrics.Token = viper.GetString("metrics.token")
 
-	if !viper.IsSet("metrics.url") {
-		return metrics, fmt.Errorf("metrics url is required")
+	return res, nil
+}
+
+func loadMetricsOutput(output map[string]interface{}, name string) (Metrics, error) {
+	metrics := Metrics{Type: MetricsWarp10}
+	if _, ok := output["type"]; ok {
+		metrics.Type, ok = output["type"].(string)
+		if !ok {
+			return metrics, fmt.Errorf("%s type should be a string", name)
+		}
+	}
+
+	switch metrics.Type {
+	case MetricsWarp10:
+		token, err := loadOutputSecret(output, "token", name)
+		if err != nil {
+			return metrics, err
+		}
+		metrics.Token = token
+
+		url, ok := output["url"]
+		if !ok {
+			return metrics, fmt.Errorf("%s url is required", name)
+		}
+		metrics.URL = fmt.Sprintf("%v", url)
+
+	case MetricsFile:
+		path, ok := output["path"]
+		if !ok {
+			return metrics, fmt.Errorf("%s path is required", name)
+		}
+		metrics.Path = fmt.Sprintf("%v", path)
+
+		format, err := loadFormat(output["format"], name)
+		if err != nil {
+			return metrics, err
+		}
+		metrics.Format = format
+
+	case MetricsStdout:
+		format, err := loadFormat(output["format"], name)
+		if err != nil {
+			return metrics, err
+		}
+		metrics.Format = format
+
+	case MetricsInfluxDB:
+		if path, ok := output["path"]; ok {
+			metrics.Path = fmt.Sprintf("%v", path)
+			break
+		}
+
+		for _, key := range []string{"url", "org", "bucket"} {
+			if _, ok := output[key]; !ok {
+				return metrics, fmt.Errorf("%s %s is required", name, key)
+			}
+		}
+		token, err := loadOutputSecret(output, "token", name)
+		if err != nil {
+			return metrics, err
+		}
+		metrics.Token = token
+		metrics.URL = fmt.Sprintf("%v", output["url"])
+		metrics.Org = fmt.Sprintf("%v", output["org"])
+		metrics.Bucket = fmt.Sprintf("%v", output["bucket"])
+
+	case MetricsOTLP:
+		url, ok := output["url"]
+		if !ok {
+			return metrics, fmt.Errorf("%s url is required", name)
+		}
+		metrics.URL = fmt.Sprintf("%v", url)
+
+		if _, ok = output["headers"]; ok {
+			headers, ok := toStringMap(output["headers"])
+			if !ok {
+				return metrics, fmt.Errorf("%s headers should be a map", name)
+			}
+			metrics.Headers = make(map[string]Secret, len(headers))
+			for key := range headers {
+				header := strings.TrimSuffix(key, "_file")
+				value, err := loadOutputSecret(headers, header, fmt.Sprintf("%s header", name))
+				if err != nil {
+					return metrics, err
+				}
+				metrics.Headers[header] = value
+			}
+		}
+
+		metrics.ResourceLabels = []string{"project"}
+		if _, ok = output["resource_labels"]; ok {
+			labels, ok := output["resource_labels"].([]interface{})
+			if !ok {
+				return metrics, fmt.Errorf("%s resource labels should be an array", name)
+			}
+			metrics.ResourceLabels = nil
+			for _, label := range labels {
+				metrics.ResourceLabels = append(metrics.ResourceLabels, fmt.Sprintf("%v", label))
+			}
+		}
+
+	default:
+		return metrics, fmt.Errorf("%s type '%s' is unknown", name, metrics.Type)
 	}
-	metrics.URL = viper.GetString("metrics.url")
 
 	return metrics, nil
 }
+
+// loadFormat check a file or stdout output format, default to gts
+func loadFormat(format interface{}, name string) (string, error) {
+	switch format {
+	case nil, "":
+		return FormatGTS, nil
+	case FormatGTS, FormatJSON:
+		return format.(string), nil
+	}
+	return "", fmt.Errorf("%s format '%v' is unknown", name, format)
+}
+
+// toStringMap convert yaml maps to string keyed maps
+func toStringMap(v interface{}) (map[string]interface{}, bool) {
+	switch m := v.(type) {
+	case map[string]interface{}:
+		return m, true
+	case map[interface{}]interface{}:
+		res := make(map[string]interface{}, len(m))
+		for key, value := range m {
+			res[fmt.Sprintf("%v", key)] = value
+		}
+		return res, true
+	}
+	return nil, false
+}
+
+func loadPrometheus() Prometheus {
+	return Prometheus{
+		Enabled: viper.GetBool("prometheus.enabled"),
+	}
+}
+
+// loadSpool read the spool params, the spool is disabled without path
+func loadSpool() (Spool, error) {
+	spool := Spool{
+		Path:       viper.GetString("spool.path"),
+		MaxSize:    100 * 1024 * 1024,
+		MaxAge:     24 * time.Hour,
+		MinBackoff: time.Minute,
+		MaxBackoff: time.Hour,
+	}
+
+	if viper.IsSet("spool.max_size") {
+		spool.MaxSize = viper.GetInt64("spool.max_size")
+	}
+	if viper.IsSet("spool.max_age") {
+		spool.MaxAge = viper.GetDuration("spool.max_age")
+	}
+	if viper.IsSet("spool.backoff.min") {
+		spool.MinBackoff = viper.GetDuration("spool.backoff.min")
+	}
+	if viper.IsSet("spool.backoff.max") {
+		spool.MaxBackoff = viper.GetDuration("spool.backoff.max")
+	}
+
+	if spool.MaxSize < 0 {
+		return spool, fmt.Errorf("spool max size should be positive")
+	}
+	if spool.MaxAge < 0 {
+		return spool, fmt.Errorf("spool max age should be positive")
+	}
+	if spool.MinBackoff <= 0 || spool.MaxBackoff <= 0 {
+		return spool, fmt.Errorf("spool backoff should be strictly positive")
+	}
+	if spool.MinBackoff > spool.MaxBackoff {
+		return spool, fmt.Errorf("spool backoff min should be lower than max")
+	}
+
+	return spool, nil
+}
+
+// loadFlow read the flow metrics params, issues resolved during the last
+// 30 days are used by default
+func loadFlow() (Flow, error) {
+	flow := Flow{
+		Enabled: viper.GetBool("flow.enabled"),
+		Window:  30 * 24 * time.Hour,
+	}
+
+	if viper.IsSet("flow.window") {
+		flow.Window = viper.GetDuration("flow.window")
+	}
+	if flow.Window <= 0 {
+		return flow, fmt.Errorf("flow window should be positive")
+	}
+
+	return flow, nil
+}
+
+// loadConcurrency read the number of projects collected at once by a runner
+func loadConcurrency() (int, error) {
+	concurrency := DefaultConcurrency
+	if viper.IsSet("runner.concurrency") {
+		concurrency = viper.GetInt("runner.concurrency")
+	}
+	if concurrency <= 0 {
+		return concurrency, fmt.Errorf("runner concurrency should be strictly positive")
+	}
+	return concurrency, nil
+}
+
+// loadVelocity read the velocity params, the last 6 closed sprints are
+// walked by default and no sprint disable the velocity history
+func loadVelocity() (Velocity, error) {
+	velocity := Velocity{
+		Sprints: 6,
+		Average: 3,
+	}
+
+	if viper.IsSet("velocity.sprints") {
+		velocity.Sprints = viper.GetInt("velocity.sprints")
+	}
+	if viper.IsSet("velocity.average") {
+		velocity.Average = viper.GetInt("velocity.average")
+	}
+
+	if velocity.Sprints < 0 {
+		return velocity, fmt.Errorf("velocity sprints should be positive")
+	}
+	if velocity.Average <= 0 {
+		return velocity, fmt.Errorf("velocity average should be strictly positive")
+	}
+
+	return velocity, nil
+}
+
+// loadBurndown read the non working days, either week days or 2006-01-02
+// dates. Saturday and sunday are non working days by default
+func loadBurndown() (Burndown, error) {
+	burndown := Burndown{}
+	days := []string{"saturday", "sunday"}
+	if viper.IsSet("burndown.non_working_days") {
+		days = viper.GetStringSlice("burndown.non_working_days")
+	}
+
+	weekdays := make(map[string]time.Weekday)
+	for weekday := time.Sunday; weekday <= time.Saturday; weekday++ {
+		weekdays[strings.ToLower(weekday.String())] = weekday
+	}
+
+	for _, day := range days {
+		if weekday, ok := weekdays[strings.ToLower(day)]; ok {
+			burndown.NonWorkingDays = append(burndown.NonWorkingDays, weekday)
+			continue
+		}
+
+		holiday, err := time.Parse("2006-01-02", day)
+		if err != nil {
+			return burndown, fmt.Errorf("burndown non working day '%s' should be a week day or a 2006-01-02 date", day)
+		}
+		burndown.Holidays = append(burndown.Holidays, holiday)
+	}
+
+	return burndown, nil
+}
+
+// loadDryRun read the dry run params, metrics are printed on stdout when
+// no path is set
+func loadDryRun() (DryRun, error) {
+	dryRun := DryRun{
+		Enabled: viper.GetBool("dryrun.enabled"),
+		Path:    viper.GetString("dryrun.path"),
+	}
+
+	format, err := loadFormat(viper.Get("dryrun.format"), "dryrun")
+	if err != nil {
+		return dryRun, err
+	}
+	dryRun.Format = format
+
+	return dryRun, nil
+}
@@ -3,6 +3,7 @@ package core
 import (
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/spf13/viper"
 
@@ -324,6 +325,691 @@ projects:
 	assert.Equal(cfg.Projects[1].Name, "OB")
 	assert.Equal(cfg.Projects[1].Board, 407)
 	assert.Equal(cfg.Jira.Username, "jerem")
-	assert.Equal(cfg.Jira.Password, "foo")
+	assert.Equal(cfg.Jira.Password.Value(), "foo")
 	assert.Equal(cfg.Jira.URL, "https://jira.com")
+	assert.Equal(cfg.Jira.Auth.Type, AuthBasic)
+	assert.Len(cfg.Metrics, 1)
+	assert.Equal(cfg.Metrics[0].Type, MetricsWarp10)
+	assert.Equal(cfg.Metrics[0].URL, "https://metrics.ovh.net")
+	assert.Equal(cfg.Metrics[0].Token.Value(), "mytoken")
+}
+func TestMissingMetricsWithPrometheus(t *testing.T) {
+	assert := require.New(t)
+
+	// Load config
+	config := `
+jira:
+  username: jerem
+  password: foo
+  url: https://jira.com
+prometheus:
+  enabled: true
+projects:
+  - name: K8S
+    board: 96`
+	loadConfig(assert, config)
+
+	cfg, err := LoadConfig()
+	assert.NoError(err)
+	assert.True(cfg.Prometheus.Enabled)
+	assert.Empty(cfg.Metrics)
+}
+func TestMissingMetricsURLWithPrometheus(t *testing.T) {
+	assert := require.New(t)
+
+	// Load config
+	config := `
+jira:
+  username: jerem
+  password: foo
+  url: https://jira.com
+metrics:
+  token: mytoken
+prometheus:
+  enabled: true
+projects:
+  - name: K8S
+    board: 96`
+	loadConfig(assert, config)
+
+	_, err := LoadConfig()
+	assert.EqualError(err, "metrics url is required")
+}
+func TestParseMetricsList(t *testing.T) {
+	assert := require.New(t)
+
+	// Load config
+	config := `
+jira:
+  username: jerem
+  password: foo
+  url: https://jira.com
+metrics:
+  - url: https://warp.gra1.metrics.ovh.net
+    token: mytoken
+  - type: warp10
+    url: https://warp.bhs1.metrics.ovh.net
+    token: othertoken
+  - type: file
+    path: /tmp/jerem.metrics
+  - type: stdout
+projects:
+  - name: K8S
+    board: 96`
+	loadConfig(assert, config)
+
+	cfg, err := LoadConfig()
+	assert.NoError(err)
+	assert.Len(cfg.Metrics, 4)
+	assert.Equal(cfg.Metrics[0], Metrics{Type: MetricsWarp10, URL: "https://warp.gra1.metrics.ovh.net", Token: "mytoken"})
+	assert.Equal(cfg.Metrics[1], Metrics{Type: MetricsWarp10, URL: "https://warp.bhs1.metrics.ovh.net", Token: "othertoken"})
+	assert.Equal(cfg.Metrics[2], Metrics{Type: MetricsFile, Path: "/tmp/jerem.metrics", Format: FormatGTS})
+	assert.Equal(cfg.Metrics[3], Metrics{Type: MetricsStdout, Format: FormatGTS})
+}
+func TestMissingMetricsListURL(t *testing.T) {
+	assert := require.New(t)
+
+	// Load config
+	config := `
+jira:
+  username: jerem
+  password: foo
+  url: https://jira.com
+metrics:
+  - type: stdout
+  - token: mytoken
+projects:
+  - name: K8S
+    board: 96`
+	loadConfig(assert, config)
+
+	_, err := LoadConfig()
+	assert.EqualError(err, "metrics 1 url is required")
+}
+func TestUnknownMetricsType(t *testing.T) {
+	assert := require.New(t)
+
+	// Load config
+	config := `
+jira:
+  username: jerem
+  password: foo
+  url: https://jira.com
+metrics:
+  - type: graphite
+projects:
+  - name: K8S
+    board: 96`
+	loadConfig(assert, config)
+
+	_, err := LoadConfig()
+	assert.EqualError(err, "metrics 0 type 'graphite' is unknown")
+}
+func TestParseInfluxDBMetrics(t *testing.T) {
+	assert := require.New(t)
+
+	// Load config
+	config := `
+jira:
+  username: jerem
+  password: foo
+  url: https://jira.com
+metrics:
+  - type: influxdb
+    url: https://influxdb.com
+    token: mytoken
+    org: ovh
+    bucket: jerem
+  - type: influxdb
+    path: /tmp/jerem.influx
+projects:
+  - name: K8S
+    board: 96`
+	loadConfig(assert, config)
+
+	cfg, err := LoadConfig()
+	assert.NoError(err)
+	assert.Equal(cfg.Metrics[0], Metrics{Type: MetricsInfluxDB, URL: "https://influxdb.com", Token: "mytoken", Org: "ovh", Bucket: "jerem"})
+	assert.Equal(cfg.Metrics[1], Metrics{Type: MetricsInfluxDB, Path: "/tmp/jerem.influx"})
+}
+func TestMissingInfluxDBBucket(t *testing.T) {
+	assert := require.New(t)
+
+	// Load config
+	config := `
+jira:
+  username: jerem
+  password: foo
+  url: https://jira.com
+metrics:
+  - type: influxdb
+    url: https://influxdb.com
+    token: mytoken
+    org: ovh
+projects:
+  - name: K8S
+    board: 96`
+	loadConfig(assert, config)
+
+	_, err := LoadConfig()
+	assert.EqualError(err, "metrics 0 bucket is required")
+}
+func TestParseOTLPMetrics(t *testing.T) {
+	assert := require.New(t)
+
+	// Load config
+	config := `
+jira:
+  username: jerem
+  password: foo
+  url: https://jira.com
+metrics:
+  - type: otlp
+    url: http://collector:4318
+    headers:
+      Authorization: Bearer mytoken
+  - type: otlp
+    url: http://collector:4318
+    resource_labels:
+      - project
+      - global
+projects:
+  - name: K8S
+    board: 96`
+	loadConfig(assert, config)
+
+	cfg, err := LoadConfig()
+	assert.NoError(err)
+	assert.Equal(cfg.Metrics[0], Metrics{Type: MetricsOTLP, URL: "http://collector:4318", Headers: map[string]Secret{"Authorization": "Bearer mytoken"}, ResourceLabels: []string{"project"}})
+	assert.Equal(cfg.Metrics[1].ResourceLabels, []string{"project", "global"})
+}
+func TestParseDryRun(t *testing.T) {
+	assert := require.New(t)
+
+	// Load config, metrics are optional in dry run
+	config := `
+jira:
+  username: jerem
+  password: foo
+  url: https://jira.com
+dryrun:
+  enabled: true
+  format: json
+  path: /tmp/jerem.json
+projects:
+  - name: K8S
+    board: 96`
+	loadConfig(assert, config)
+
+	cfg, err := LoadConfig()
+	assert.NoError(err)
+	assert.Empty(cfg.Metrics)
+	assert.Equal(cfg.DryRun, DryRun{Enabled: true, Format: FormatJSON, Path: "/tmp/jerem.json"})
+}
+func TestUnknownDryRunFormat(t *testing.T) {
+	assert := require.New(t)
+
+	// Load config
+	config := `
+jira:
+  username: jerem
+  password: foo
+  url: https://jira.com
+dryrun:
+  enabled: true
+  format: xml
+projects:
+  - name: K8S
+    board: 96`
+	loadConfig(assert, config)
+
+	_, err := LoadConfig()
+	assert.EqualError(err, "dryrun format 'xml' is unknown")
+}
+func TestParseFields(t *testing.T) {
+	assert := require.New(t)
+
+	// Load config
+	config := `
+jira:
+  username: jerem
+  password: foo
+  url: https://jira.com
+  fields:
+    storypoint: Story Points
+metrics:
+  url: https://metrics.ovh.net
+  token: mytoken
+projects:
+  - name: K8S
+    board: 96
+  - name: OB
+    board: 407
+    fields:
+      storypoint: customfield_10016
+      impediment: Blocker type`
+	loadConfig(assert, config)
+
+	cfg, err := LoadConfig()
+	assert.NoError(err)
+	assert.Equal(cfg.Jira.Fields, Fields{StoryPoint: "Story Points", Impediment: DefaultImpedimentField})
+	assert.Equal(cfg.Projects[0].Fields, cfg.Jira.Fields)
+	assert.Equal(cfg.Projects[1].Fields, Fields{StoryPoint: "customfield_10016", Impediment: "Blocker type"})
+}
+func TestParseBearerAuth(t *testing.T) {
+	assert := require.New(t)
+
+	// Load config, username and password are only required by basic auth
+	config := `
+jira:
+  url: https://jira.com
+  auth:
+    type: bearer
+    token: mytoken
+metrics:
+  url: https://metrics.ovh.net
+  token: mytoken
+projects:
+  - name: K8S
+    board: 96`
+	loadConfig(assert, config)
+
+	cfg, err := LoadConfig()
+	assert.NoError(err)
+	assert.Equal(cfg.Jira.Auth, Auth{Type: AuthBearer, Token: "mytoken"})
+}
+func TestMissingOAuth1PrivateKey(t *testing.T) {
+	assert := require.New(t)
+
+	// Load config
+	config := `
+jira:
+  url: https://jira.com
+  auth:
+    type: oauth1
+    consumer_key: jerem
+    token: mytoken
+metrics:
+  url: https://metrics.ovh.net
+  token: mytoken
+projects:
+  - name: K8S
+    board: 96`
+	loadConfig(assert, config)
+
+	_, err := LoadConfig()
+	assert.EqualError(err, "jira auth private key is required")
+}
+func TestParseSpool(t *testing.T) {
+	assert := require.New(t)
+
+	// Load config
+	config := `
+jira:
+  username: jerem
+  password: foo
+  url: https://jira.com
+metrics:
+  url: https://warp.io
+  token: bar
+projects:
+  - name: K8S
+    board: 96`
+	loadConfig(assert, config)
+
+	cfg, err := LoadConfig()
+	assert.NoError(err)
+	assert.Equal(Spool{MaxSize: 100 * 1024 * 1024, MaxAge: 24 * time.Hour, MinBackoff: time.Minute, MaxBackoff: time.Hour}, cfg.Spool)
+
+	for spool, expected := range map[string]string{
+		"max_size: -1":           "spool max size should be positive",
+		"max_age: -1h":           "spool max age should be positive",
+		"backoff:\n    min: -1m": "spool backoff should be strictly positive",
+		"backoff:\n    max: 0s":  "spool backoff should be strictly positive",
+	} {
+		loadConfig(assert, config+"\nspool:\n  path: /tmp/jerem\n  "+spool)
+
+		_, err = LoadConfig()
+		assert.EqualError(err, expected)
+	}
+}
+func TestParseFlow(t *testing.T) {
+	assert := require.New(t)
+
+	// Load config
+	config := `
+jira:
+  username: jerem
+  password: foo
+  url: https://jira.com
+metrics:
+  url: https://warp.io
+  token: bar
+flow:
+  enabled: true
+  window: 336h
+projects:
+  - name: K8S
+    board: 96`
+	loadConfig(assert, config)
+
+	cfg, err := LoadConfig()
+	assert.NoError(err)
+	assert.Equal(cfg.Flow, Flow{Enabled: true, Window: 14 * 24 * time.Hour})
+	assert.False(cfg.Board.Enabled)
+}
+func TestParseVelocity(t *testing.T) {
+	assert := require.New(t)
+
+	// Load config
+	config := `
+jira:
+  username: jerem
+  password: foo
+  url: https://jira.com
+metrics:
+  url: https://warp.io
+  token: bar
+projects:
+  - name: K8S
+    board: 96`
+	loadConfig(assert, config)
+
+	cfg, err := LoadConfig()
+	assert.NoError(err)
+	assert.Equal(cfg.Velocity, Velocity{Sprints: 6, Average: 3})
+
+	config += `
+velocity:
+  sprints: 12
+  average: 0`
+	loadConfig(assert, config)
+
+	_, err = LoadConfig()
+	assert.EqualError(err, "velocity average should be strictly positive")
+}
+func TestParseConcurrency(t *testing.T) {
+	assert := require.New(t)
+
+	// Load config
+	config := `
+jira:
+  username: jerem
+  password: foo
+  url: https://jira.com
+metrics:
+  url: https://warp.io
+  token: bar
+projects:
+  - name: K8S
+    board: 96`
+	loadConfig(assert, config)
+
+	cfg, err := LoadConfig()
+	assert.NoError(err)
+	assert.Equal(DefaultConcurrency, cfg.Concurrency)
+	assert.Equal(float64(DefaultRateLimit), cfg.Jira.RateLimit)
+
+	loadConfig(assert, strings.Replace(config, "  url: https://jira.com", "  url: https://jira.com\n  rate_limit: 2.5", 1)+`
+runner:
+  concurrency: 8`)
+
+	cfg, err = LoadConfig()
+	assert.NoError(err)
+	assert.Equal(8, cfg.Concurrency)
+	assert.Equal(2.5, cfg.Jira.RateLimit)
+
+	loadConfig(assert, config+`
+runner:
+  concurrency: 0`)
+
+	_, err = LoadConfig()
+	assert.EqualError(err, "runner concurrency should be strictly positive")
+
+	loadConfig(assert, strings.Replace(config, "  url: https://jira.com", "  url: https://jira.com\n  rate_limit: -1", 1))
+
+	_, err = LoadConfig()
+	assert.EqualError(err, "jira rate limit should be positive")
+}
+func TestParseJiraRetry(t *testing.T) {
+	assert := require.New(t)
+
+	// Load config
+	config := `
+jira:
+  username: jerem
+  password: foo
+  url: https://jira.com
+metrics:
+  url: https://warp.io
+  token: bar
+projects:
+  - name: K8S
+    board: 96`
+	loadConfig(assert, config)
+
+	cfg, err := LoadConfig()
+	assert.NoError(err)
+	assert.Equal(DefaultTimeout, cfg.Jira.Timeout)
+	assert.Equal(Retry{Max: DefaultRetries, Backoff: DefaultBackoff, MaxBackoff: DefaultMaxBackoff}, cfg.Jira.Retry)
+
+	jira := `
+  timeout: 10s
+  retry:
+    max: 5
+    backoff: 500ms
+    max_backoff: 1m`
+	loadConfig(assert, strings.Replace(config, "  url: https://jira.com", "  url: https://jira.com"+jira, 1))
+
+	cfg, err = LoadConfig()
+	assert.NoError(err)
+	assert.Equal(10*time.Second, cfg.Jira.Timeout)
+	assert.Equal(Retry{Max: 5, Backoff: 500 * time.Millisecond, MaxBackoff: time.Minute}, cfg.Jira.Retry)
+
+	jira = `
+  retry:
+    backoff: 1m
+    max_backoff: 1s`
+	loadConfig(assert, strings.Replace(config, "  url: https://jira.com", "  url: https://jira.com"+jira, 1))
+
+	_, err = LoadConfig()
+	assert.EqualError(err, "jira retry max backoff should be greater than the backoff")
+}
+func TestParseBurndown(t *testing.T) {
+	assert := require.New(t)
+
+	// Load config
+	config := `
+jira:
+  username: jerem
+  password: foo
+  url: https://jira.com
+metrics:
+  url: https://warp.io
+  token: bar
+burndown:
+  non_working_days:
+    - Friday
+    - saturday
+    - 2020-12-25
+projects:
+  - name: K8S
+    board: 96`
+	loadConfig(assert, config)
+
+	cfg, err := LoadConfig()
+	assert.NoError(err)
+	assert.Equal([]time.Weekday{time.Friday, time.Saturday}, cfg.Burndown.NonWorkingDays)
+	assert.False(cfg.Burndown.IsWorkingDay(time.Date(2020, 12, 25, 10, 0, 0, 0, time.UTC)))
+	assert.False(cfg.Burndown.IsWorkingDay(time.Date(2020, 12, 26, 10, 0, 0, 0, time.UTC)))
+	assert.True(cfg.Burndown.IsWorkingDay(time.Date(2020, 12, 27, 10, 0, 0, 0, time.UTC)))
+
+	loadConfig(assert, strings.Replace(config, "2020-12-25", "someday", 1))
+
+	_, err = LoadConfig()
+	assert.EqualError(err, "burndown non working day 'someday' should be a week day or a 2006-01-02 date")
+}
+func TestProjectMode(t *testing.T) {
+	assert := require.New(t)
+
+	// Load config
+	config := `
+jira:
+  username: jerem
+  password: foo
+  url: https://jira.com
+metrics:
+  url: https://metrics.ovh.net
+  token: mytoken
+projects:
+  - name: K8S
+    board: 94
+    mode: kanban
+  - name: OB
+    board: 95`
+	loadConfig(assert, config)
+
+	conf, err := LoadConfig()
+	assert.NoError(err)
+	assert.Equal(ModeKanban, conf.Projects[0].Mode)
+	assert.Equal("", conf.Projects[1].Mode)
+
+	loadConfig(assert, strings.Replace(config, "mode: kanban", "mode: scrumban", 1))
+
+	_, err = LoadConfig()
+	assert.EqualError(err, "project 0 mode should be scrum or kanban")
+}
+func TestParsePeriods(t *testing.T) {
+	assert := require.New(t)
+
+	// Load config
+	config := `
+jira:
+  username: jerem
+  password: foo
+  url: https://jira.com
+metrics:
+  url: https://metrics.ovh.net
+  token: mytoken
+periods:
+  patterns:
+    - ^(H[12]-\d{2})$
+  fallback: duedate
+  unit: half
+projects:
+  - name: K8S
+    board: 94
+  - name: OB
+    board: 95
+    periods:
+      patterns:
+        - ^PI-(\d{4}\.\d)$
+      fallback: fixversion`
+	loadConfig(assert, config)
+
+	conf, err := LoadConfig()
+	assert.NoError(err)
+	assert.Equal(conf.Periods, conf.Projects[0].Periods)
+	assert.Equal(PeriodFallbackDueDate, conf.Projects[0].Periods.Fallback)
+	assert.Equal(PeriodHalf, conf.Projects[0].Periods.Unit)
+	assert.Equal(`^(H[12]-\d{2})$`, conf.Projects[0].Periods.Patterns[0].String())
+	assert.Equal(PeriodFallbackFixVersion, conf.Projects[1].Periods.Fallback)
+	assert.Equal(PeriodHalf, conf.Projects[1].Periods.Unit)
+	assert.Equal(`^PI-(\d{4}\.\d)$`, conf.Projects[1].Periods.Patterns[0].String())
+
+	loadConfig(assert, strings.Replace(config, `^PI-(\d{4}\.\d)$`, `^PI-(`, 1))
+
+	_, err = LoadConfig()
+	assert.EqualError(err, "project 1 period pattern '^PI-(' is invalid: error parsing regexp: missing closing ): `^PI-(`")
+}
+func TestDefaultPeriods(t *testing.T) {
+	assert := require.New(t)
+
+	// Load config
+	config := `
+jira:
+  username: jerem
+  password: foo
+  url: https://jira.com
+metrics:
+  url: https://metrics.ovh.net
+  token: mytoken
+projects:
+  - name: K8S
+    board: 94`
+	loadConfig(assert, config)
+
+	conf, err := LoadConfig()
+	assert.NoError(err)
+	assert.Equal(PeriodFallbackNone, conf.Projects[0].Periods.Fallback)
+	assert.Equal(DefaultPeriodPattern, conf.Projects[0].Periods.Patterns[0].String())
+}
+func TestParseDimensions(t *testing.T) {
+	assert := require.New(t)
+
+	// Load config
+	config := `
+jira:
+  username: jerem
+  password: foo
+  url: https://jira.com
+metrics:
+  url: https://metrics.ovh.net
+  token: mytoken
+dimensions:
+  - label: team
+    prefix: Team_
+  - label: okr
+    regex: ^OKR[-_](.+)$
+    default: none
+projects:
+  - name: K8S
+    board: 94`
+	loadConfig(assert, config)
+
+	conf, err := LoadConfig()
+	assert.NoError(err)
+	assert.Len(conf.Dimensions, 3)
+	assert.Equal(defaultDimension(), conf.Dimensions[0])
+	assert.Equal(Dimension{Label: "team", Prefix: "Team_", Default: "None"}, conf.Dimensions[1])
+	assert.Equal("okr", conf.Dimensions[2].Label)
+	assert.Equal("none", conf.Dimensions[2].Default)
+	assert.Equal(`^OKR[-_](.+)$`, conf.Dimensions[2].Regex.String())
+
+	loadConfig(assert, strings.Replace(config, "label: team", "label: quarter", 1))
+
+	_, err = LoadConfig()
+	assert.EqualError(err, "dimension 0 label 'quarter' is reserved")
+}
+func TestProjectEpicChildren(t *testing.T) {
+	assert := require.New(t)
+
+	// Load config
+	config := `
+jira:
+  username: jerem
+  password: foo
+  url: https://jira.com
+metrics:
+  url: https://metrics.ovh.net
+  token: mytoken
+projects:
+  - name: K8S
+    board: 94
+  - name: OB
+    board: 95
+    epic_children: jql
+    epic_children_jql: parent = {key} OR "Epic Link" = {key}`
+	loadConfig(assert, config)
+
+	conf, err := LoadConfig()
+	assert.NoError(err)
+	assert.Equal(EpicChildrenAuto, conf.Projects[0].EpicChildren)
+	assert.Equal(EpicChildrenJql, conf.Projects[1].EpicChildren)
+	assert.Equal(`parent = {key} OR "Epic Link" = {key}`, conf.Projects[1].EpicChildrenJql)
+
+	loadConfig(assert, strings.Replace(config, "{key}", "PJ1-1", -1))
+
+	_, err = LoadConfig()
+	assert.EqualError(err, "project 1 epic children jql is required and should contain {key}")
 }
@@ -0,0 +1,129 @@
+package core
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// Epic series labels which can't be set by a dimension
+var reservedLabels = []string{"project", "key", "summary", "quarter"}
+
+// Dimension define a rule extracting an epic series label from the epic
+// labels, matched by prefix or by regex. The value is the label without its
+// prefix, or the first capture group of the regex
+type Dimension struct {
+	Label   string
+	Prefix  string
+	Regex   *regexp.Regexp
+	Default string
+
+	// trimCutset trim the prefix characters instead of the prefix, to keep
+	// the values of the default global dimension series
+	trimCutset bool
+}
+
+// Value return the dimension value of the epic labels, the last matching
+// label wins
+func (d Dimension) Value(labels []string) string {
+	value := d.Default
+	for _, label := range labels {
+		if d.Regex != nil {
+			match := d.Regex.FindStringSubmatch(label)
+			if match == nil {
+				continue
+			}
+			value = match[0]
+			if len(match) > 1 {
+				value = match[1]
+			}
+			continue
+		}
+
+		if !strings.HasPrefix(label, d.Prefix) {
+			continue
+		}
+		if d.trimCutset {
+			value = strings.TrimLeft(label, d.Prefix)
+		} else {
+			value = strings.TrimPrefix(label, d.Prefix)
+		}
+	}
+	return value
+}
+
+// defaultDimension return the global dimension read from the Project_
+// prefixed labels. Its value still trims the prefix characters so the
+// existing series don't change, Project_object gives bject
+func defaultDimension() Dimension {
+	return Dimension{Label: "global", Prefix: "Project_", Default: "None", trimCutset: true}
+}
+
+// loadDimensions read the epic dimensions, the global dimension is read
+// from the Project_ prefixed labels unless configured
+func loadDimensions() ([]Dimension, error) {
+	dimensions := []Dimension{defaultDimension()}
+	if !viper.IsSet("dimensions") {
+		return dimensions, nil
+	}
+
+	list, ok := viper.Get("dimensions").([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("dimensions should be an array")
+	}
+
+	for idx, d := range list {
+		settings, ok := toStringMap(d)
+		if !ok {
+			return nil, fmt.Errorf("dimension %d should be a map", idx)
+		}
+
+		label, ok := settings["label"].(string)
+		if !ok || label == "" {
+			return nil, fmt.Errorf("dimension %d label is required", idx)
+		}
+		for _, reserved := range reservedLabels {
+			if label == reserved {
+				return nil, fmt.Errorf("dimension %d label '%s' is reserved", idx, label)
+			}
+		}
+
+		dimension := Dimension{Label: label, Default: "None"}
+		if value, ok := settings["default"]; ok {
+			dimension.Default = fmt.Sprintf("%v", value)
+		}
+
+		prefix, hasPrefix := settings["prefix"]
+		regex, hasRegex := settings["regex"]
+		switch {
+		case hasPrefix && hasRegex:
+			return nil, fmt.Errorf("dimension %d should have either a prefix or a regex", idx)
+		case hasPrefix:
+			dimension.Prefix = fmt.Sprintf("%v", prefix)
+		case hasRegex:
+			pattern, err := regexp.Compile(fmt.Sprintf("%v", regex))
+			if err != nil {
+				return nil, fmt.Errorf("dimension %d regex '%v' is invalid: %s", idx, regex, err)
+			}
+			dimension.Regex = pattern
+		default:
+			return nil, fmt.Errorf("dimension %d prefix or regex is required", idx)
+		}
+
+		// A configured dimension override the default one
+		replaced := false
+		for i := range dimensions {
+			if dimensions[i].Label == label {
+				dimensions[i] = dimension
+				replaced = true
+			}
+		}
+		if !replaced {
+			dimensions = append(dimensions, dimension)
+		}
+	}
+
+	return dimensions, nil
+}
@@ -0,0 +1,28 @@
+package core
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDimensionValue(t *testing.T) {
+	assert := require.New(t)
+
+	// The default global dimension keeps the values of its existing series
+	global := defaultDimension()
+	assert.Equal("Jerem", global.Value([]string{"Q3-24", "Project_Jerem"}))
+	assert.Equal("bject", global.Value([]string{"Project_object"}))
+	assert.Equal("st", global.Value([]string{"Project_test"}))
+	assert.Equal("None", global.Value([]string{"Q3-24"}))
+
+	// A configured prefix is only trimmed once
+	global = Dimension{Label: "global", Prefix: "Project_", Default: "None"}
+	assert.Equal("object", global.Value([]string{"Project_object"}))
+	assert.Equal("test", global.Value([]string{"Project_test"}))
+
+	okr := Dimension{Label: "okr", Regex: regexp.MustCompile(`^OKR[-_](.+)$`), Default: "none"}
+	assert.Equal("Reliability", okr.Value([]string{"OKR-Reliability"}))
+	assert.Equal("none", okr.Value(nil))
+}
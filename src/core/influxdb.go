@@ -0,0 +1,145 @@
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	warp "github.com/PierreZ/Warp10Exporter"
+)
+
+var influxMeasurementReplacer = strings.NewReplacer(`,`, `\,`, ` `, `\ `)
+var influxTagReplacer = strings.NewReplacer(`,`, `\,`, `=`, `\=`, ` `, `\ `)
+var influxStringReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+// InfluxSink write batches in the InfluxDB line protocol to an InfluxDB v2
+// write endpoint or to a file
+type InfluxSink struct {
+	URL    string
+	Token  Secret
+	Org    string
+	Bucket string
+	Path   string
+}
+
+// Name return the sink name
+func (i *InfluxSink) Name() string {
+	if i.Path != "" {
+		return fmt.Sprintf("%s %s", MetricsInfluxDB, i.Path)
+	}
+	return fmt.Sprintf("%s %s", MetricsInfluxDB, i.URL)
+}
+
+// Write render the batch and send it, empty batches are skipped
+func (i *InfluxSink) Write(runner string, batch *warp.Batch) error {
+	if len(*batch) == 0 {
+		return nil
+	}
+
+	var b bytes.Buffer
+	RenderLineProtocol(&b, batch)
+
+	if i.Path != "" {
+		file, err := os.OpenFile(i.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return err
+		}
+		if _, err = file.Write(b.Bytes()); err != nil {
+			file.Close()
+			return err
+		}
+		return file.Close()
+	}
+
+	query := url.Values{}
+	query.Set("org", i.Org)
+	query.Set("bucket", i.Bucket)
+	query.Set("precision", "ns")
+
+	req, err := http.NewRequest("POST", fmt.Sprintf("%s/api/v2/write?%s", strings.TrimSuffix(i.URL, "/"), query.Encode()), &b)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("Token %s", i.Token.Value()))
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("InfluxDB response status is %d, body='%s'", resp.StatusCode, string(body))
+	}
+	return nil
+}
+
+// RenderLineProtocol write each datapoint of the batch as a line protocol
+// point, GTS labels become tags and the value is stored in the value field
+func RenderLineProtocol(b *bytes.Buffer, batch *warp.Batch) {
+	// Sort series to get a stable output
+	ids := make([]string, 0, len(*batch))
+	for id := range *batch {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		gts := (*batch)[id]
+		measurement, err := url.QueryUnescape(gts.Classname)
+		if err != nil {
+			measurement = gts.Classname
+		}
+		series := influxMeasurementReplacer.Replace(measurement) + influxTags(gts.Labels)
+
+		for _, dp := range gts.Datapoints {
+			field, ok := influxField(dp.Value)
+			if !ok {
+				continue
+			}
+			b.WriteString(fmt.Sprintf("%s value=%s %d\n", series, field, dp.Timestamp.UnixNano()))
+		}
+	}
+}
+
+func influxTags(labels map[string]string) string {
+	tags := ""
+	for _, key := range sortedKeys(labels) {
+		// Empty tag values are not allowed by the line protocol
+		if labels[key] == "" {
+			continue
+		}
+		tags += fmt.Sprintf(",%s=%s", influxTagReplacer.Replace(key), influxTagReplacer.Replace(labels[key]))
+	}
+	return tags
+}
+
+// influxField format a datapoint value, numbers are always written as
+// floats so a series keep the same field type, even once spooled
+func influxField(value interface{}) (string, bool) {
+	switch v := value.(type) {
+	case int:
+		return strconv.FormatFloat(float64(v), 'f', -1, 64), true
+	case int32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 64), true
+	case int64:
+		return strconv.FormatFloat(float64(v), 'f', -1, 64), true
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 64), true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case bool:
+		return strconv.FormatBool(v), true
+	case string:
+		return fmt.Sprintf("\"%s\"", influxStringReplacer.Replace(v)), true
+	}
+	return "", false
+}
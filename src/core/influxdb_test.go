@@ -0,0 +1,54 @@
+package core
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	warp "github.com/PierreZ/Warp10Exporter"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRenderLineProtocol(t *testing.T) {
+	assert := require.New(t)
+
+	batch := warp.NewBatch()
+	batch.Register(warp.NewGTS("jerem.jira.epic.storypoint").WithLabels(warp.Labels{
+		"project": "K8S",
+		"summary": "My epic, v2",
+		"global":  "",
+	}).AddDatapoint(time.Unix(1, 0), 12))
+	batch.Register(warp.NewGTS("jerem.jira.sprint.events").WithLabels(warp.Labels{
+		"project": "K8S",
+		"sprint":  "current",
+	}).AddDatapoint(time.Unix(1, 0), "start").AddDatapoint(time.Unix(2, 0), "end"))
+
+	var b bytes.Buffer
+	RenderLineProtocol(&b, batch)
+
+	assert.Contains(b.String(), "jerem.jira.epic.storypoint,project=K8S,summary=My\\ epic\\,\\ v2 value=12 1000000000\n")
+	assert.Contains(b.String(), "jerem.jira.sprint.events,project=K8S,sprint=current value=\"start\" 1000000000\n")
+	assert.Contains(b.String(), "jerem.jira.sprint.events,project=K8S,sprint=current value=\"end\" 2000000000\n")
+}
+
+func TestInfluxSinkWrite(t *testing.T) {
+	assert := require.New(t)
+
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal("/api/v2/write", r.URL.Path)
+		assert.Equal("jerem", r.URL.Query().Get("bucket"))
+		assert.Equal("ovh", r.URL.Query().Get("org"))
+		assert.Equal("Token mytoken", r.Header.Get("Authorization"))
+		body, _ = ioutil.ReadAll(r.Body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	sink := &InfluxSink{URL: server.URL, Token: "mytoken", Org: "ovh", Bucket: "jerem"}
+	assert.NoError(sink.Write("epic", testBatch()))
+	assert.Equal("jerem.jira.epic.storypoint,project=K8S value=42 1000000000\n", string(body))
+}
@@ -0,0 +1,225 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	warp "github.com/PierreZ/Warp10Exporter"
+)
+
+// OTLP/HTTP JSON payload, see opentelemetry-proto metrics/v1
+type otlpRequest struct {
+	ResourceMetrics []otlpResourceMetrics `json:"resourceMetrics"`
+}
+
+type otlpResourceMetrics struct {
+	Resource     otlpResource       `json:"resource"`
+	ScopeMetrics []otlpScopeMetrics `json:"scopeMetrics"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeMetrics struct {
+	Scope   otlpScope    `json:"scope"`
+	Metrics []otlpMetric `json:"metrics"`
+}
+
+type otlpScope struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type otlpMetric struct {
+	Name  string    `json:"name"`
+	Gauge otlpGauge `json:"gauge"`
+}
+
+type otlpGauge struct {
+	DataPoints []otlpDataPoint `json:"dataPoints"`
+}
+
+type otlpDataPoint struct {
+	Attributes   []otlpAttribute `json:"attributes"`
+	TimeUnixNano string          `json:"timeUnixNano"`
+	AsDouble     float64         `json:"asDouble"`
+}
+
+type otlpAttribute struct {
+	Key   string        `json:"key"`
+	Value otlpAttrValue `json:"value"`
+}
+
+type otlpAttrValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+// OTLPSink send batches as OTLP gauges to an OpenTelemetry collector
+type OTLPSink struct {
+	URL            string
+	Headers        map[string]Secret
+	ResourceLabels []string
+}
+
+// Name return the sink name
+func (o *OTLPSink) Name() string {
+	return fmt.Sprintf("%s %s", MetricsOTLP, o.URL)
+}
+
+// Write send the batch, empty batches are skipped
+func (o *OTLPSink) Write(runner string, batch *warp.Batch) error {
+	request := o.request(batch)
+	if len(request.ResourceMetrics) == 0 {
+		return nil
+	}
+
+	body, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", fmt.Sprintf("%s/v1/metrics", strings.TrimSuffix(o.URL, "/")), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range o.Headers {
+		req.Header.Set(key, value.Value())
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		b, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("OTLP response status is %d, body='%s'", resp.StatusCode, string(b))
+	}
+	return nil
+}
+
+// request group the batch series by resource, resource labels becoming
+// resource attributes and the other ones data point attributes
+func (o *OTLPSink) request(batch *warp.Batch) otlpRequest {
+	resources := make(map[string]*otlpResourceMetrics)
+	metrics := make(map[string]map[string]*otlpMetric)
+
+	for _, gts := range *batch {
+		var resourceAttributes, attributes []otlpAttribute
+		for _, key := range sortedKeys(gts.Labels) {
+			attribute := otlpAttribute{Key: key, Value: otlpAttrValue{StringValue: gts.Labels[key]}}
+			if o.isResourceLabel(key) {
+				resourceAttributes = append(resourceAttributes, attribute)
+			} else {
+				attributes = append(attributes, attribute)
+			}
+		}
+
+		var dataPoints []otlpDataPoint
+		for _, dp := range gts.Datapoints {
+			value, ok := otlpValue(dp.Value)
+			if !ok {
+				continue
+			}
+			dataPoints = append(dataPoints, otlpDataPoint{
+				Attributes:   attributes,
+				TimeUnixNano: strconv.FormatInt(dp.Timestamp.UnixNano(), 10),
+				AsDouble:     value,
+			})
+		}
+		if len(dataPoints) == 0 {
+			continue
+		}
+
+		resourceID := fmt.Sprintf("%v", resourceAttributes)
+		resource, ok := resources[resourceID]
+		if !ok {
+			resource = &otlpResourceMetrics{
+				Resource: otlpResource{Attributes: append([]otlpAttribute{
+					{Key: "service.name", Value: otlpAttrValue{StringValue: "jerem"}},
+					{Key: "service.version", Value: otlpAttrValue{StringValue: Version}},
+				}, resourceAttributes...)},
+			}
+			resources[resourceID] = resource
+			metrics[resourceID] = make(map[string]*otlpMetric)
+		}
+
+		name, err := url.QueryUnescape(gts.Classname)
+		if err != nil {
+			name = gts.Classname
+		}
+		metric, ok := metrics[resourceID][name]
+		if !ok {
+			metric = &otlpMetric{Name: name}
+			metrics[resourceID][name] = metric
+		}
+		metric.Gauge.DataPoints = append(metric.Gauge.DataPoints, dataPoints...)
+	}
+
+	// Sort resources and metrics to get a stable payload
+	ids := make([]string, 0, len(resources))
+	for id := range resources {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	request := otlpRequest{}
+	for _, resourceID := range ids {
+		resource := resources[resourceID]
+		names := make([]string, 0, len(metrics[resourceID]))
+		for name := range metrics[resourceID] {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		scope := otlpScopeMetrics{Scope: otlpScope{Name: "jerem", Version: Version}}
+		for _, name := range names {
+			scope.Metrics = append(scope.Metrics, *metrics[resourceID][name])
+		}
+		resource.ScopeMetrics = []otlpScopeMetrics{scope}
+		request.ResourceMetrics = append(request.ResourceMetrics, *resource)
+	}
+	return request
+}
+
+func (o *OTLPSink) isResourceLabel(label string) bool {
+	for _, resourceLabel := range o.ResourceLabels {
+		if label == resourceLabel {
+			return true
+		}
+	}
+	return false
+}
+
+// otlpValue convert a datapoint value to a gauge value, string series
+// (like sprint events) can't be exported as gauges
+func otlpValue(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case float32:
+		return float64(v), true
+	case float64:
+		return v, true
+	case bool:
+		if v {
+			return 1, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
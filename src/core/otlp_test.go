@@ -0,0 +1,54 @@
+package core
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	warp "github.com/PierreZ/Warp10Exporter"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOTLPSinkWrite(t *testing.T) {
+	assert := require.New(t)
+
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal("/v1/metrics", r.URL.Path)
+		assert.Equal("application/json", r.Header.Get("Content-Type"))
+		assert.Equal("secret", r.Header.Get("X-Token"))
+		body, _ = ioutil.ReadAll(r.Body)
+	}))
+	defer server.Close()
+
+	batch := warp.NewBatch()
+	batch.Register(warp.NewGTS("jerem.jira.epic.storypoint").WithLabels(warp.Labels{
+		"project": "K8S",
+		"key":     "K8S-1",
+	}).AddDatapoint(time.Unix(1, 0), 12))
+	batch.Register(warp.NewGTS("jerem.jira.sprint.events").WithLabels(warp.Labels{
+		"project": "K8S",
+	}).AddDatapoint(time.Unix(1, 0), "start"))
+
+	sink := &OTLPSink{URL: server.URL, Headers: map[string]Secret{"X-Token": "secret"}, ResourceLabels: []string{"project"}}
+	assert.NoError(sink.Write("epic", batch))
+
+	request := otlpRequest{}
+	assert.NoError(json.Unmarshal(body, &request))
+	assert.Len(request.ResourceMetrics, 1)
+
+	resource := request.ResourceMetrics[0]
+	assert.Contains(resource.Resource.Attributes, otlpAttribute{Key: "project", Value: otlpAttrValue{StringValue: "K8S"}})
+	assert.Equal(otlpScope{Name: "jerem", Version: Version}, resource.ScopeMetrics[0].Scope)
+	assert.Equal([]otlpMetric{{
+		Name: "jerem.jira.epic.storypoint",
+		Gauge: otlpGauge{DataPoints: []otlpDataPoint{{
+			Attributes:   []otlpAttribute{{Key: "key", Value: otlpAttrValue{StringValue: "K8S-1"}}},
+			TimeUnixNano: "1000000000",
+			AsDouble:     12,
+		}}},
+	}}, resource.ScopeMetrics[0].Metrics)
+}
@@ -0,0 +1,97 @@
+package core
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// DefaultPeriodPattern match quarter labels like Q3-24
+const DefaultPeriodPattern = `^Q[1-4]-\d{2}$`
+
+// Period fallbacks, used when no epic label match the period patterns
+const (
+	PeriodFallbackNone       = "none"
+	PeriodFallbackDueDate    = "duedate"
+	PeriodFallbackFixVersion = "fixversion"
+)
+
+// Period units of the periods derived from a due date
+const (
+	PeriodQuarter = "quarter"
+	PeriodHalf    = "half"
+	PeriodYear    = "year"
+)
+
+// Periods define how the planning period of an epic is read from its
+// labels. The first capture group of a pattern is the period, or the whole
+// label without group
+type Periods struct {
+	Patterns []*regexp.Regexp
+	Fallback string
+	Unit     string
+}
+
+// Match return the period of a label, if it matches a pattern
+func (p Periods) Match(label string) (string, bool) {
+	for _, pattern := range p.Patterns {
+		match := pattern.FindStringSubmatch(label)
+		if match == nil {
+			continue
+		}
+		if len(match) > 1 && match[1] != "" {
+			return match[1], true
+		}
+		return match[0], true
+	}
+	return "", false
+}
+
+// Of return the period of a date, like Q3-24, H2-24 or 2024
+func (p Periods) Of(date time.Time) string {
+	switch p.Unit {
+	case PeriodHalf:
+		return fmt.Sprintf("H%d-%02d", (int(date.Month())-1)/6+1, date.Year()%100)
+	case PeriodYear:
+		return fmt.Sprintf("%d", date.Year())
+	}
+	return fmt.Sprintf("Q%d-%02d", (int(date.Month())-1)/3+1, date.Year()%100)
+}
+
+// loadPeriods read the periods params, unset ones keep their default
+func loadPeriods(periods map[string]interface{}, defaults Periods, name string) (Periods, error) {
+	res := defaults
+
+	if patterns, ok := periods["patterns"]; ok {
+		list, ok := patterns.([]interface{})
+		if !ok || len(list) == 0 {
+			return res, fmt.Errorf("%s periods patterns should be a non empty list", name)
+		}
+
+		res.Patterns = nil
+		for _, p := range list {
+			pattern, err := regexp.Compile(fmt.Sprintf("%v", p))
+			if err != nil {
+				return res, fmt.Errorf("%s period pattern '%v' is invalid: %s", name, p, err)
+			}
+			res.Patterns = append(res.Patterns, pattern)
+		}
+	}
+
+	if fallback, ok := periods["fallback"]; ok {
+		res.Fallback = strings.ToLower(fmt.Sprintf("%v", fallback))
+		if res.Fallback != PeriodFallbackNone && res.Fallback != PeriodFallbackDueDate && res.Fallback != PeriodFallbackFixVersion {
+			return res, fmt.Errorf("%s periods fallback '%s' is unknown", name, res.Fallback)
+		}
+	}
+
+	if unit, ok := periods["unit"]; ok {
+		res.Unit = strings.ToLower(fmt.Sprintf("%v", unit))
+		if res.Unit != PeriodQuarter && res.Unit != PeriodHalf && res.Unit != PeriodYear {
+			return res, fmt.Errorf("%s periods unit '%s' is unknown", name, res.Unit)
+		}
+	}
+
+	return res, nil
+}
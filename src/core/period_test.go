@@ -0,0 +1,38 @@
+package core
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPeriodsMatch(t *testing.T) {
+	assert := require.New(t)
+
+	periods := Periods{Patterns: []*regexp.Regexp{
+		regexp.MustCompile(DefaultPeriodPattern),
+		regexp.MustCompile(`^PI-(\d{4}\.\d)$`),
+	}}
+
+	period, ok := periods.Match("Q3-24")
+	assert.True(ok)
+	assert.Equal("Q3-24", period)
+
+	period, ok = periods.Match("PI-2024.3")
+	assert.True(ok)
+	assert.Equal("2024.3", period)
+
+	_, ok = periods.Match("Project_Jerem")
+	assert.False(ok)
+}
+
+func TestPeriodsOf(t *testing.T) {
+	assert := require.New(t)
+
+	date := time.Date(2024, 8, 15, 0, 0, 0, 0, time.UTC)
+	assert.Equal("Q3-24", Periods{Unit: PeriodQuarter}.Of(date))
+	assert.Equal("H2-24", Periods{Unit: PeriodHalf}.Of(date))
+	assert.Equal("2024", Periods{Unit: PeriodYear}.Of(date))
+}
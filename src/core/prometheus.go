@@ -0,0 +1,135 @@
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	warp "github.com/PierreZ/Warp10Exporter"
+)
+
+// Prometheus exposition content types
+const (
+	PrometheusContentType  = "text/plain; version=0.0.4; charset=utf-8"
+	OpenMetricsContentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+)
+
+var invalidMetricChars = regexp.MustCompile(`[^a-zA-Z0-9_:]`)
+var invalidLabelChars = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+var labelValueReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// PrometheusExporter keep the last batch of each runner to expose it as gauges
+type PrometheusExporter struct {
+	mutex   sync.RWMutex
+	batches map[string]*warp.Batch
+}
+
+// NewPrometheusExporter create an empty prometheus exporter
+func NewPrometheusExporter() *PrometheusExporter {
+	return &PrometheusExporter{
+		batches: make(map[string]*warp.Batch),
+	}
+}
+
+// Update replace the series exposed for a runner by the given batch
+func (p *PrometheusExporter) Update(runner string, batch *warp.Batch) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.batches[runner] = batch
+}
+
+// Name return the sink name
+func (p *PrometheusExporter) Name() string {
+	return "prometheus"
+}
+
+// Write expose the batch, it implements Sink
+func (p *PrometheusExporter) Write(runner string, batch *warp.Batch) error {
+	p.Update(runner, batch)
+	return nil
+}
+
+// Render write all exposed series in the prometheus text format,
+// or in the OpenMetrics one when openMetrics is set
+func (p *PrometheusExporter) Render(b *bytes.Buffer, openMetrics bool) {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	// Group samples by metric name, a TYPE line must be unique per metric
+	samples := make(map[string][]string)
+	for _, batch := range p.batches {
+		for _, gts := range *batch {
+			value, ok := prometheusValue(gts)
+			if !ok {
+				continue
+			}
+			name := prometheusName(gts.Classname)
+			samples[name] = append(samples[name], fmt.Sprintf("%s{%s} %s", name, prometheusLabels(gts.Labels), value))
+		}
+	}
+
+	names := make([]string, 0, len(samples))
+	for name := range samples {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		b.WriteString(fmt.Sprintf("# TYPE %s gauge\n", name))
+		sort.Strings(samples[name])
+		for _, sample := range samples[name] {
+			b.WriteString(sample)
+			b.WriteString("\n")
+		}
+	}
+
+	if openMetrics {
+		b.WriteString("# EOF\n")
+	}
+}
+
+func prometheusName(classname string) string {
+	name, err := url.QueryUnescape(classname)
+	if err != nil {
+		name = classname
+	}
+	return invalidMetricChars.ReplaceAllString(name, "_")
+}
+
+func prometheusLabels(labels map[string]string) string {
+	pairs := make([]string, 0, len(labels))
+	for _, key := range sortedKeys(labels) {
+		pairs = append(pairs, fmt.Sprintf("%s=\"%s\"", invalidLabelChars.ReplaceAllString(key, "_"), labelValueReplacer.Replace(labels[key])))
+	}
+	return strings.Join(pairs, ",")
+}
+
+// prometheusValue return the most recent numeric value of a GTS,
+// string series (like sprint events) can't be exposed as gauges
+func prometheusValue(gts *warp.GTS) (string, bool) {
+	if len(gts.Datapoints) == 0 {
+		return "", false
+	}
+
+	last := gts.Datapoints[0]
+	for _, dp := range gts.Datapoints[1:] {
+		if dp.Timestamp.After(last.Timestamp) {
+			last = dp
+		}
+	}
+
+	switch v := last.Value.(type) {
+	case int, int32, int64, float32, float64:
+		return fmt.Sprintf("%v", v), true
+	case bool:
+		if v {
+			return "1", true
+		}
+		return "0", true
+	}
+	return "", false
+}
@@ -0,0 +1,52 @@
+package core
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	warp "github.com/PierreZ/Warp10Exporter"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrometheusRender(t *testing.T) {
+	assert := require.New(t)
+
+	now := time.Now()
+	batch := warp.NewBatch()
+	batch.Register(warp.NewGTS("jerem.jira.epic.storypoint").WithLabels(warp.Labels{
+		"project": "K8S",
+		"key":     "K8S-1",
+		"summary": `My "epic"`,
+	}).AddDatapoint(now, 12.5))
+	batch.Register(warp.NewGTS("jerem.jira.sprint.events").WithLabels(warp.Labels{
+		"project": "K8S",
+	}).AddDatapoint(now, "start"))
+	batch.Register(warp.NewGTS("jerem.jira.impediment.total.created").WithLabels(warp.Labels{
+		"project": "K8S",
+	}).AddDatapoint(now, 60).AddDatapoint(now.Add(-time.Hour), 30))
+
+	exporter := NewPrometheusExporter()
+	exporter.Update("epic", batch)
+
+	var b bytes.Buffer
+	exporter.Render(&b, false)
+
+	assert.Equal(`# TYPE jerem_jira_epic_storypoint gauge
+jerem_jira_epic_storypoint{key="K8S-1",project="K8S",summary="My \"epic\""} 12.5
+# TYPE jerem_jira_impediment_total_created gauge
+jerem_jira_impediment_total_created{project="K8S"} 60
+`, b.String())
+}
+
+func TestPrometheusRenderOpenMetrics(t *testing.T) {
+	assert := require.New(t)
+
+	exporter := NewPrometheusExporter()
+	exporter.Update("sprint", warp.NewBatch())
+
+	var b bytes.Buffer
+	exporter.Render(&b, true)
+
+	assert.Equal("# EOF\n", b.String())
+}
@@ -0,0 +1,105 @@
+package core
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// ConfigStore hold the active config, runners get a snapshot at each run
+// so a reloaded config is only used from the next run
+type ConfigStore struct {
+	mutex  sync.RWMutex
+	config Config
+}
+
+// NewConfigStore create a store holding the given config
+func NewConfigStore(config Config) *ConfigStore {
+	return &ConfigStore{config: config}
+}
+
+// Get return the active config
+func (s *ConfigStore) Get() Config {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.config
+}
+
+// Swap replace the active config and return the previous one
+func (s *ConfigStore) Swap(config Config) Config {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	previous := s.config
+	s.config = config
+	return previous
+}
+
+// ProjectsDiff list the projects added, removed or changed between two
+// configs, projects are identified by their label
+type ProjectsDiff struct {
+	Added   []string
+	Removed []string
+	Changed []string
+}
+
+// Empty return true when projects didn't change
+func (d ProjectsDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// DiffProjects compare the projects of two configs
+func DiffProjects(previous, next []Project) ProjectsDiff {
+	diff := ProjectsDiff{}
+
+	projects := make(map[string]Project, len(previous))
+	for _, project := range previous {
+		projects[project.Label] = project
+	}
+
+	seen := make(map[string]bool, len(next))
+	for _, project := range next {
+		seen[project.Label] = true
+		old, ok := projects[project.Label]
+		if !ok {
+			diff.Added = append(diff.Added, projectID(project))
+			continue
+		}
+		if !reflect.DeepEqual(old, project) {
+			diff.Changed = append(diff.Changed, projectID(project))
+		}
+	}
+
+	for _, project := range previous {
+		if !seen[project.Label] {
+			diff.Removed = append(diff.Removed, projectID(project))
+		}
+	}
+
+	return diff
+}
+
+// RestartChanges list the settings changed between two configs which are
+// only read at startup, like the metrics sinks, a reload can't apply them
+func RestartChanges(previous, next Config) []string {
+	var changes []string
+	if !reflect.DeepEqual(previous.Metrics, next.Metrics) {
+		changes = append(changes, "metrics")
+	}
+	if !reflect.DeepEqual(previous.Prometheus, next.Prometheus) {
+		changes = append(changes, "prometheus")
+	}
+	if !reflect.DeepEqual(previous.Spool, next.Spool) {
+		changes = append(changes, "spool")
+	}
+	if !reflect.DeepEqual(previous.DryRun, next.DryRun) {
+		changes = append(changes, "dryrun")
+	}
+	return changes
+}
+
+func projectID(project Project) string {
+	if project.Label == project.Name {
+		return project.Name
+	}
+	return fmt.Sprintf("%s (%s)", project.Label, project.Name)
+}
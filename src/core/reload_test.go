@@ -0,0 +1,58 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffProjects(t *testing.T) {
+	assert := require.New(t)
+
+	previous := []Project{
+		{Name: "K8S", Label: "K8S", Board: 1},
+		{Name: "OB", Label: "OB_test", Board: 2},
+		{Name: "SAN", Label: "SAN", Board: 3},
+	}
+	next := []Project{
+		{Name: "K8S", Label: "K8S", Board: 1},
+		{Name: "OB", Label: "OB_test", Board: 2, Jql: "AND (component = test)"},
+		{Name: "NET", Label: "NET", Board: 4},
+	}
+
+	diff := DiffProjects(previous, next)
+	assert.Equal(ProjectsDiff{
+		Added:   []string{"NET"},
+		Removed: []string{"SAN"},
+		Changed: []string{"OB_test (OB)"},
+	}, diff)
+	assert.False(diff.Empty())
+	assert.True(DiffProjects(previous, previous).Empty())
+}
+
+func TestConfigStoreSwap(t *testing.T) {
+	assert := require.New(t)
+
+	store := NewConfigStore(Config{Projects: []Project{{Name: "K8S"}}})
+	previous := store.Swap(Config{Projects: []Project{{Name: "OB"}}})
+	assert.Equal("K8S", previous.Projects[0].Name)
+	assert.Equal("OB", store.Get().Projects[0].Name)
+}
+
+func TestRestartChanges(t *testing.T) {
+	assert := require.New(t)
+
+	previous := Config{
+		Metrics: []Metrics{{URL: "https://warp.io"}},
+		Spool:   Spool{Path: "/var/lib/jerem"},
+	}
+	assert.Empty(RestartChanges(previous, previous))
+
+	next := previous
+	next.Projects = []Project{{Name: "K8S", Label: "K8S"}}
+	assert.Empty(RestartChanges(previous, next))
+
+	next.Metrics = []Metrics{{URL: "https://warp.io"}, {URL: "https://influx.io"}}
+	next.DryRun = DryRun{Enabled: true}
+	assert.Equal([]string{"metrics", "dryrun"}, RestartChanges(previous, next))
+}
@@ -0,0 +1,131 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+const redacted = "<redacted>"
+
+var envRegex = regexp.MustCompile(`\$\{([a-zA-Z_][a-zA-Z0-9_]*)\}`)
+
+// Secret is a sensitive config value, it is redacted when printed or
+// serialized so it can't leak in logs or config dumps
+type Secret string
+
+// Value return the secret in clear
+func (s Secret) Value() string {
+	return string(s)
+}
+
+// String redact the secret
+func (s Secret) String() string {
+	if s == "" {
+		return ""
+	}
+	return redacted
+}
+
+// GoString redact the secret
+func (s Secret) GoString() string {
+	return fmt.Sprintf("%q", s.String())
+}
+
+// MarshalJSON redact the secret
+func (s Secret) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+// ExpandConfigEnv expand ${ENV} references to environment variables in the
+// values of the config file found by viper. Values are expanded once
+// decoded, so an environment variable can't alter the config structure
+func ExpandConfigEnv() error {
+	file := viper.New()
+	file.SetConfigFile(viper.ConfigFileUsed())
+	if err := file.ReadInConfig(); err != nil {
+		return err
+	}
+
+	var missing []string
+	settings := file.AllSettings()
+	for key, value := range settings {
+		settings[key] = expandEnv(value, &missing)
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("config references undefined environment variables %s", strings.Join(missing, ", "))
+	}
+	return viper.MergeConfigMap(settings)
+}
+
+// expandEnv replace ${ENV} references in the strings of a decoded config
+// value, an undefined variable is added to missing to not silently use an
+// empty secret
+func expandEnv(value interface{}, missing *[]string) interface{} {
+	switch v := value.(type) {
+	case string:
+		return envRegex.ReplaceAllStringFunc(v, func(match string) string {
+			name := envRegex.FindStringSubmatch(match)[1]
+			env, ok := os.LookupEnv(name)
+			if !ok {
+				*missing = append(*missing, name)
+			}
+			return env
+		})
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = expandEnv(item, missing)
+		}
+	case map[interface{}]interface{}:
+		for key, item := range v {
+			v[key] = expandEnv(item, missing)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = expandEnv(item, missing)
+		}
+	}
+	return value
+}
+
+// loadSecret read a secret from its key, or from the file set in its
+// _file variant, like kubernetes or docker secrets
+func loadSecret(key string) (Secret, error) {
+	if viper.IsSet(key + "_file") {
+		return readSecretFile(viper.GetString(key + "_file"))
+	}
+
+	if !viper.IsSet(key) {
+		return "", fmt.Errorf("%s is required", strings.Replace(strings.Replace(key, ".", " ", -1), "_", " ", -1))
+	}
+	return Secret(viper.GetString(key)), nil
+}
+
+// loadOutputSecret read a metrics output secret from its key, or from the
+// file set in its _file variant
+func loadOutputSecret(output map[string]interface{}, key, name string) (Secret, error) {
+	if path, ok := output[key+"_file"]; ok {
+		return readSecretFile(fmt.Sprintf("%v", path))
+	}
+
+	value, ok := output[key]
+	if !ok {
+		return "", fmt.Errorf("%s %s is required", name, key)
+	}
+	return Secret(fmt.Sprintf("%v", value)), nil
+}
+
+// readSecretFile read a secret file, trailing new lines are ignored
+func readSecretFile(path string) (Secret, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("fail to read secret file: %s", err)
+	}
+	return Secret(strings.TrimRight(string(content), "\r\n")), nil
+}
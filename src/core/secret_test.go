@@ -0,0 +1,129 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSecretRedaction(t *testing.T) {
+	assert := require.New(t)
+
+	jira := Jira{Username: "jerem", Password: "foo"}
+	assert.NotContains(fmt.Sprintf("%v %+v %#v %s", jira, jira, jira, jira.Password), "foo")
+
+	content, err := json.Marshal(Metrics{Token: "mytoken", Headers: map[string]Secret{"Authorization": "Bearer mytoken"}})
+	assert.NoError(err)
+	assert.NotContains(string(content), "mytoken")
+	assert.Contains(string(content), "redacted")
+
+	assert.Equal("foo", jira.Password.Value())
+	assert.Equal("", Secret("").String())
+}
+
+func TestExpandEnv(t *testing.T) {
+	assert := require.New(t)
+
+	os.Setenv("JEREM_TEST_PASSWORD", "foo$bar")
+	defer os.Unsetenv("JEREM_TEST_PASSWORD")
+
+	var missing []string
+	value := expandEnv(map[string]interface{}{
+		"password": "${JEREM_TEST_PASSWORD}",
+		"token":    "$NOT_EXPANDED",
+		"outputs":  []interface{}{map[interface{}]interface{}{"token": "${JEREM_TEST_PASSWORD}"}},
+		"board":    96,
+	}, &missing)
+	assert.Empty(missing)
+	assert.Equal(map[string]interface{}{
+		"password": "foo$bar",
+		"token":    "$NOT_EXPANDED",
+		"outputs":  []interface{}{map[interface{}]interface{}{"token": "foo$bar"}},
+		"board":    96,
+	}, value)
+
+	expandEnv("${JEREM_TEST_UNDEFINED}", &missing)
+	assert.Equal([]string{"JEREM_TEST_UNDEFINED"}, missing)
+}
+
+func TestExpandConfigEnv(t *testing.T) {
+	assert := require.New(t)
+
+	dir, err := ioutil.TempDir("", "jerem")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	os.Setenv("JEREM_TEST_URL", "https://jira.com")
+	defer os.Unsetenv("JEREM_TEST_URL")
+	os.Setenv("JEREM_TEST_PASSWORD", "p@ss #1: *x")
+	defer os.Unsetenv("JEREM_TEST_PASSWORD")
+
+	// Expanded values are not parsed, commented references are ignored
+	path := filepath.Join(dir, "config.yml")
+	assert.NoError(ioutil.WriteFile(path, []byte(`jira:
+  url: ${JEREM_TEST_URL}
+  password: ${JEREM_TEST_PASSWORD}
+  # username: ${JEREM_TEST_UNDEFINED}
+metrics:
+  - url: https://warp.io
+    token: ${JEREM_TEST_PASSWORD}
+`), 0644))
+
+	viper.SetConfigFile(path)
+	defer viper.SetConfigFile("")
+	assert.NoError(viper.ReadInConfig())
+	assert.NoError(ExpandConfigEnv())
+	assert.Equal("https://jira.com", viper.GetString("jira.url"))
+	assert.Equal("p@ss #1: *x", viper.GetString("jira.password"))
+
+	outputs, ok := viper.Get("metrics").([]interface{})
+	assert.True(ok)
+	assert.Equal("p@ss #1: *x", outputs[0].(map[interface{}]interface{})["token"])
+
+	// Undefined variables are still refused
+	assert.NoError(ioutil.WriteFile(path, []byte("jira:\n  url: ${JEREM_TEST_UNDEFINED}\n"), 0644))
+	assert.NoError(viper.ReadInConfig())
+	assert.EqualError(ExpandConfigEnv(), "config references undefined environment variables JEREM_TEST_UNDEFINED")
+}
+
+func TestSecretFiles(t *testing.T) {
+	assert := require.New(t)
+
+	dir, err := ioutil.TempDir("", "jerem")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	assert.NoError(ioutil.WriteFile(filepath.Join(dir, "password"), []byte("foo\n"), 0600))
+	assert.NoError(ioutil.WriteFile(filepath.Join(dir, "token"), []byte("mytoken"), 0600))
+
+	// Load config
+	config := fmt.Sprintf(`
+jira:
+  username: jerem
+  password_file: %s
+  url: https://jira.com
+metrics:
+  - url: https://metrics.ovh.net
+    token_file: %s
+  - type: otlp
+    url: http://collector:4318
+    headers:
+      Authorization_file: %s
+      X-Scope: jerem
+projects:
+  - name: K8S
+    board: 96`, filepath.Join(dir, "password"), filepath.Join(dir, "token"), filepath.Join(dir, "token"))
+	loadConfig(require.New(t), config)
+
+	cfg, err := LoadConfig()
+	assert.NoError(err)
+	assert.Equal("foo", cfg.Jira.Password.Value())
+	assert.Equal("mytoken", cfg.Metrics[0].Token.Value())
+	assert.Equal(map[string]Secret{"Authorization": "mytoken", "X-Scope": "jerem"}, cfg.Metrics[1].Headers)
+}
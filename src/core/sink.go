@@ -0,0 +1,233 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	warp "github.com/PierreZ/Warp10Exporter"
+)
+
+// Sink is a metrics destination receiving the batch computed by a runner
+type Sink interface {
+	Name() string
+	Write(runner string, batch *warp.Batch) error
+}
+
+// NewSink create the sink matching a metrics output config
+func NewSink(metrics Metrics) (Sink, error) {
+	switch metrics.Type {
+	case MetricsWarp10:
+		return &WarpSink{URL: metrics.URL, Token: metrics.Token}, nil
+	case MetricsFile:
+		return &FileSink{Path: metrics.Path, Format: metrics.Format}, nil
+	case MetricsStdout:
+		return &WriterSink{name: MetricsStdout, writer: os.Stdout, format: metrics.Format}, nil
+	case MetricsInfluxDB:
+		return &InfluxSink{URL: metrics.URL, Token: metrics.Token, Org: metrics.Org, Bucket: metrics.Bucket, Path: metrics.Path}, nil
+	case MetricsOTLP:
+		return &OTLPSink{URL: metrics.URL, Headers: metrics.Headers, ResourceLabels: metrics.ResourceLabels}, nil
+	}
+	return nil, fmt.Errorf("unknown metrics type '%s'", metrics.Type)
+}
+
+// NewSinks create a fan-out sink over all configured metrics outputs,
+// outputs that may fail are spooled when a spool path is set. In dry run,
+// the only sink print the metrics instead
+func NewSinks(config Config) (Sinks, error) {
+	if config.DryRun.Enabled {
+		metrics := Metrics{Type: MetricsStdout, Format: config.DryRun.Format}
+		if config.DryRun.Path != "" {
+			metrics = Metrics{Type: MetricsFile, Path: config.DryRun.Path, Format: config.DryRun.Format}
+		}
+
+		sink, err := NewSink(metrics)
+		if err != nil {
+			return nil, err
+		}
+		return Sinks{sink}, nil
+	}
+
+	var sinks Sinks
+	for _, metrics := range config.Metrics {
+		sink, err := NewSink(metrics)
+		if err != nil {
+			return nil, err
+		}
+
+		if config.Spool.Path != "" && metrics.Type != MetricsStdout {
+			sink, err = NewSpoolSink(sink, config.Spool)
+			if err != nil {
+				return nil, err
+			}
+		}
+		sinks = append(sinks, sink)
+	}
+	return sinks, nil
+}
+
+// Sinks fan out each batch to several sinks
+type Sinks []Sink
+
+// Name return the names of all sinks
+func (s Sinks) Name() string {
+	names := make([]string, 0, len(s))
+	for _, sink := range s {
+		names = append(names, sink.Name())
+	}
+	return strings.Join(names, ", ")
+}
+
+// Write send the batch to every sink, a failing sink doesn't prevent
+// the others to receive the batch
+func (s Sinks) Write(runner string, batch *warp.Batch) error {
+	var errs []string
+	for _, sink := range s {
+		if err := sink.Write(runner, batch); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %s", sink.Name(), err))
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("%d/%d sinks failed: %s", len(errs), len(s), strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// WarpSink push batches to a Warp 10 backend
+type WarpSink struct {
+	URL   string
+	Token Secret
+}
+
+// Name return the sink name
+func (w *WarpSink) Name() string {
+	return fmt.Sprintf("%s %s", MetricsWarp10, w.URL)
+}
+
+// Write push the batch, empty batches are skipped
+func (w *WarpSink) Write(runner string, batch *warp.Batch) error {
+	if len(*batch) == 0 {
+		return nil
+	}
+	return batch.Push(w.URL, w.Token.Value())
+}
+
+// FileSink append batches in the Warp 10 input format, or as JSON, to a file
+type FileSink struct {
+	Path   string
+	Format string
+}
+
+// Name return the sink name
+func (f *FileSink) Name() string {
+	return fmt.Sprintf("%s %s", MetricsFile, f.Path)
+}
+
+// Write append the batch to the file
+func (f *FileSink) Write(runner string, batch *warp.Batch) error {
+	file, err := os.OpenFile(f.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	sink := WriterSink{name: f.Name(), writer: file, format: f.Format}
+	if err = sink.Write(runner, batch); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// WriterSink write batches in the Warp 10 input format, or as JSON, to a writer
+type WriterSink struct {
+	name   string
+	writer io.Writer
+	format string
+}
+
+// Name return the sink name
+func (w *WriterSink) Name() string {
+	return w.name
+}
+
+// Write print the batch, one datapoint per line in the Warp 10 input
+// format or one series per line in JSON
+func (w *WriterSink) Write(runner string, batch *warp.Batch) error {
+	if len(*batch) == 0 {
+		return nil
+	}
+
+	var b bytes.Buffer
+	if w.format == FormatJSON {
+		if err := renderJSON(&b, runner, batch); err != nil {
+			return err
+		}
+	} else {
+		batch.Print(&b)
+		b.WriteString("\n")
+	}
+
+	_, err := w.writer.Write(b.Bytes())
+	return err
+}
+
+type jsonDatapoint struct {
+	Timestamp time.Time   `json:"timestamp"`
+	Value     interface{} `json:"value"`
+}
+
+type jsonGTS struct {
+	Runner     string            `json:"runner"`
+	Class      string            `json:"class"`
+	Labels     map[string]string `json:"labels"`
+	Datapoints []jsonDatapoint   `json:"datapoints"`
+}
+
+// renderJSON write each series of the batch as a JSON object on its own line
+func renderJSON(b *bytes.Buffer, runner string, batch *warp.Batch) error {
+	// Sort series to get a stable output
+	ids := make([]string, 0, len(*batch))
+	for id := range *batch {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		gts := (*batch)[id]
+		class, err := url.QueryUnescape(gts.Classname)
+		if err != nil {
+			class = gts.Classname
+		}
+
+		series := jsonGTS{Runner: runner, Class: class, Labels: gts.Labels}
+		for _, dp := range gts.Datapoints {
+			series.Datapoints = append(series.Datapoints, jsonDatapoint{Timestamp: dp.Timestamp.UTC(), Value: dp.Value})
+		}
+
+		line, err := json.Marshal(series)
+		if err != nil {
+			return err
+		}
+		b.Write(line)
+		b.WriteString("\n")
+	}
+	return nil
+}
+
+// sortedKeys return the keys of a labels map in order, to render series
+// in a stable way
+func sortedKeys(labels map[string]string) []string {
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,82 @@
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	warp "github.com/PierreZ/Warp10Exporter"
+	"github.com/stretchr/testify/require"
+)
+
+type failingSink struct{}
+
+func (f *failingSink) Name() string {
+	return "failing"
+}
+
+func (f *failingSink) Write(runner string, batch *warp.Batch) error {
+	return fmt.Errorf("unavailable")
+}
+
+func testBatch() *warp.Batch {
+	batch := warp.NewBatch()
+	batch.Register(warp.NewGTS("jerem.jira.epic.storypoint").WithLabels(warp.Labels{
+		"project": "K8S",
+	}).AddDatapoint(time.Unix(1, 0), 42))
+	return batch
+}
+
+func TestFileSinkAppend(t *testing.T) {
+	assert := require.New(t)
+
+	dir, err := ioutil.TempDir("", "jerem")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	sink := &FileSink{Path: filepath.Join(dir, "jerem.metrics")}
+	assert.NoError(sink.Write("epic", testBatch()))
+	assert.NoError(sink.Write("epic", testBatch()))
+
+	content, err := ioutil.ReadFile(sink.Path)
+	assert.NoError(err)
+	assert.Equal("1000000// jerem.jira.epic.storypoint{project=K8S} 42\n1000000// jerem.jira.epic.storypoint{project=K8S} 42\n", string(content))
+}
+
+func TestSinksFanOut(t *testing.T) {
+	assert := require.New(t)
+
+	var b bytes.Buffer
+	exporter := NewPrometheusExporter()
+	sinks := Sinks{&failingSink{}, &WriterSink{name: "buffer", writer: &b}, exporter}
+
+	err := sinks.Write("epic", testBatch())
+	assert.EqualError(err, "1/3 sinks failed: failing: unavailable")
+	assert.Equal("1000000// jerem.jira.epic.storypoint{project=K8S} 42\n", b.String())
+	assert.Len(exporter.batches, 1)
+	assert.Equal("failing, buffer, prometheus", sinks.Name())
+}
+
+func TestWriterSinkJSON(t *testing.T) {
+	assert := require.New(t)
+
+	var b bytes.Buffer
+	sink := &WriterSink{name: "buffer", writer: &b, format: FormatJSON}
+	assert.NoError(sink.Write("epic", testBatch()))
+	assert.Equal(`{"runner":"epic","class":"jerem.jira.epic.storypoint","labels":{"project":"K8S"},"datapoints":[{"timestamp":"1970-01-01T00:00:01Z","value":42}]}`+"\n", b.String())
+}
+
+func TestDryRunSinks(t *testing.T) {
+	assert := require.New(t)
+
+	sinks, err := NewSinks(Config{
+		Metrics: []Metrics{{Type: MetricsWarp10, URL: "https://warp.com", Token: "mytoken"}},
+		DryRun:  DryRun{Enabled: true, Format: FormatGTS},
+	})
+	assert.NoError(err)
+	assert.Equal("stdout", sinks.Name())
+}
@@ -0,0 +1,237 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	warp "github.com/PierreZ/Warp10Exporter"
+	log "github.com/sirupsen/logrus"
+)
+
+const spoolExtension = ".json"
+
+var invalidSpoolChars = regexp.MustCompile(`[^a-zA-Z0-9]+`)
+
+// SpoolDepth describe the batches waiting in a spool
+type SpoolDepth struct {
+	Batches int   `json:"batches"`
+	Bytes   int64 `json:"bytes"`
+}
+
+// spooledBatch is the on disk format of a failed batch
+type spooledBatch struct {
+	Runner string     `json:"runner"`
+	Batch  warp.Batch `json:"batch"`
+}
+
+// SpoolSink persist the batches its sink failed to write and replay them
+// with an exponential backoff on the next writes. The depth is a snapshot
+// with its own lock, so it can be read while a write is hanging
+type SpoolSink struct {
+	sink    Sink
+	dir     string
+	config  Spool
+	mutex   sync.Mutex
+	backoff time.Duration
+	retry   time.Time
+
+	depthMutex sync.Mutex
+	depth      SpoolDepth
+}
+
+// NewSpoolSink wrap a sink with a spool stored in its own sub directory
+func NewSpoolSink(sink Sink, config Spool) (*SpoolSink, error) {
+	dir := filepath.Join(config.Path, strings.Trim(invalidSpoolChars.ReplaceAllString(sink.Name(), "_"), "_"))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	s := &SpoolSink{
+		sink:   sink,
+		dir:    dir,
+		config: config,
+	}
+	s.updateDepth()
+	return s, nil
+}
+
+// Name return the wrapped sink name
+func (s *SpoolSink) Name() string {
+	return s.sink.Name()
+}
+
+// Write replay the spooled batches when the backoff is elapsed then write
+// the batch, spooling it on failure
+func (s *SpoolSink) Write(runner string, batch *warp.Batch) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	defer s.updateDepth()
+
+	now := time.Now()
+	if !now.Before(s.retry) {
+		s.replay(now)
+	}
+
+	err := s.sink.Write(runner, batch)
+	if err == nil {
+		return nil
+	}
+
+	if spoolErr := s.spool(now, runner, batch); spoolErr != nil {
+		return fmt.Errorf("%s, and fail to spool it: %s", err, spoolErr)
+	}
+	s.clean(now)
+	return fmt.Errorf("%s, batch spooled", err)
+}
+
+// Depth return the number and the size of the spooled batches
+func (s *SpoolSink) Depth() SpoolDepth {
+	s.depthMutex.Lock()
+	defer s.depthMutex.Unlock()
+	return s.depth
+}
+
+// updateDepth snapshot the spool depth, the spool lock must be held
+func (s *SpoolSink) updateDepth() {
+	depth := SpoolDepth{}
+	files, err := s.files()
+	if err != nil {
+		log.WithField("sink", s.Name()).WithError(err).Warn("Fail to read spool")
+	}
+	for _, file := range files {
+		depth.Batches++
+		depth.Bytes += file.Size()
+	}
+
+	s.depthMutex.Lock()
+	s.depth = depth
+	s.depthMutex.Unlock()
+}
+
+// replay write spooled batches from the oldest one and stop at the first
+// failure, doubling the backoff
+func (s *SpoolSink) replay(now time.Time) {
+	files, err := s.files()
+	if err != nil {
+		log.WithField("sink", s.Name()).WithError(err).Warn("Fail to read spool")
+		return
+	}
+
+	for _, file := range files {
+		path := filepath.Join(s.dir, file.Name())
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			log.WithField("file", path).WithError(err).Warn("Fail to read spooled batch")
+			continue
+		}
+
+		spooled := spooledBatch{}
+		if err = json.Unmarshal(content, &spooled); err != nil {
+			log.WithField("file", path).WithError(err).Warn("Drop invalid spooled batch")
+			os.Remove(path)
+			continue
+		}
+
+		if err = s.sink.Write(spooled.Runner, &spooled.Batch); err != nil {
+			s.backoff *= 2
+			if s.backoff < s.config.MinBackoff {
+				s.backoff = s.config.MinBackoff
+			}
+			if s.backoff > s.config.MaxBackoff {
+				s.backoff = s.config.MaxBackoff
+			}
+			s.retry = now.Add(s.backoff)
+			log.WithFields(log.Fields{"sink": s.Name(), "retry": s.retry}).WithError(err).Warn("Fail to replay spooled batch")
+			return
+		}
+
+		log.WithFields(log.Fields{"sink": s.Name(), "file": path}).Info("Spooled batch replayed")
+		os.Remove(path)
+	}
+
+	s.backoff = 0
+}
+
+func (s *SpoolSink) spool(now time.Time, runner string, batch *warp.Batch) error {
+	content, err := json.Marshal(spooledBatch{Runner: runner, Batch: *batch})
+	if err != nil {
+		return err
+	}
+
+	// Write then rename so a partial file is never replayed
+	path := filepath.Join(s.dir, fmt.Sprintf("%020d-%s", now.UnixNano(), runner))
+	if err = ioutil.WriteFile(path+".tmp", content, 0644); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path+spoolExtension)
+}
+
+// clean drop the spooled batches older than the max age, then the oldest
+// ones until the spool fit in its max size
+func (s *SpoolSink) clean(now time.Time) {
+	files, err := s.files()
+	if err != nil {
+		log.WithField("sink", s.Name()).WithError(err).Warn("Fail to read spool")
+		return
+	}
+
+	var size int64
+	for _, file := range files {
+		size += file.Size()
+	}
+
+	for _, file := range files {
+		expired := s.config.MaxAge > 0 && now.Sub(file.ModTime()) > s.config.MaxAge
+		oversized := s.config.MaxSize > 0 && size > s.config.MaxSize
+		if !expired && !oversized {
+			break
+		}
+
+		path := filepath.Join(s.dir, file.Name())
+		log.WithFields(log.Fields{"sink": s.Name(), "file": path}).Warn("Drop spooled batch")
+		if err := os.Remove(path); err != nil {
+			log.WithField("file", path).WithError(err).Warn("Fail to drop spooled batch")
+			continue
+		}
+		size -= file.Size()
+	}
+}
+
+// files return the spooled batches, oldest first
+func (s *SpoolSink) files() ([]os.FileInfo, error) {
+	infos, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []os.FileInfo
+	for _, info := range infos {
+		if !info.IsDir() && strings.HasSuffix(info.Name(), spoolExtension) {
+			files = append(files, info)
+		}
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Name() < files[j].Name()
+	})
+	return files, nil
+}
+
+// SpoolDepths return the depth of every spooled sink
+func SpoolDepths(sinks Sinks) map[string]SpoolDepth {
+	depths := make(map[string]SpoolDepth)
+	for _, sink := range sinks {
+		if spool, ok := sink.(*SpoolSink); ok {
+			depths[spool.Name()] = spool.Depth()
+		}
+	}
+	return depths
+}
@@ -0,0 +1,132 @@
+package core
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	warp "github.com/PierreZ/Warp10Exporter"
+	"github.com/stretchr/testify/require"
+)
+
+type flakySink struct {
+	fail    bool
+	batches []*warp.Batch
+}
+
+func (f *flakySink) Name() string {
+	return "warp10 https://warp.com"
+}
+
+func (f *flakySink) Write(runner string, batch *warp.Batch) error {
+	if f.fail {
+		return fmt.Errorf("unavailable")
+	}
+	f.batches = append(f.batches, batch)
+	return nil
+}
+
+func TestSpoolReplay(t *testing.T) {
+	assert := require.New(t)
+
+	dir, err := ioutil.TempDir("", "jerem")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	sink := &flakySink{fail: true}
+	spool, err := NewSpoolSink(sink, Spool{Path: dir, MinBackoff: time.Minute, MaxBackoff: time.Hour})
+	assert.NoError(err)
+	assert.Equal(dir+"/warp10_https_warp_com", spool.dir)
+
+	assert.EqualError(spool.Write("epic", testBatch()), "unavailable, batch spooled")
+	assert.Equal(SpoolDepth{Batches: 1, Bytes: spool.Depth().Bytes}, spool.Depth())
+
+	// The replay fail, the backoff is started
+	assert.Error(spool.Write("epic", testBatch()))
+	assert.Equal(2, spool.Depth().Batches)
+	assert.Equal(time.Minute, spool.backoff)
+
+	// Backoff isn't elapsed, spooled batches are kept
+	sink.fail = false
+	assert.NoError(spool.Write("epic", testBatch()))
+	assert.Len(sink.batches, 1)
+	assert.Equal(2, spool.Depth().Batches)
+
+	// Backoff is elapsed, spooled batches are replayed
+	spool.retry = time.Now()
+	assert.NoError(spool.Write("sprint", testBatch()))
+	assert.Len(sink.batches, 4)
+	assert.Equal(0, spool.Depth().Batches)
+	assert.Equal(time.Duration(0), spool.backoff)
+
+	for _, gts := range *sink.batches[1] {
+		assert.Equal("jerem.jira.epic.storypoint", gts.Classname)
+		assert.Equal(float64(42), gts.Datapoints[0].Value)
+	}
+}
+
+func TestSpoolMaxSize(t *testing.T) {
+	assert := require.New(t)
+
+	dir, err := ioutil.TempDir("", "jerem")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	spool, err := NewSpoolSink(&flakySink{fail: true}, Spool{Path: dir, MaxSize: 1, MinBackoff: time.Hour, MaxBackoff: time.Hour})
+	assert.NoError(err)
+
+	assert.Error(spool.Write("epic", testBatch()))
+	assert.Equal(SpoolDepth{}, spool.Depth())
+}
+
+// blockingSink hang its writes until it is released
+type blockingSink struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func (b *blockingSink) Name() string {
+	return "blocking"
+}
+
+func (b *blockingSink) Write(runner string, batch *warp.Batch) error {
+	close(b.started)
+	<-b.release
+	return fmt.Errorf("unavailable")
+}
+
+func TestSpoolDepthDuringWrite(t *testing.T) {
+	assert := require.New(t)
+
+	dir, err := ioutil.TempDir("", "jerem")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	sink := &blockingSink{started: make(chan struct{}), release: make(chan struct{})}
+	spool, err := NewSpoolSink(sink, Spool{Path: dir, MinBackoff: time.Minute, MaxBackoff: time.Hour})
+	assert.NoError(err)
+
+	done := make(chan error)
+	go func() {
+		done <- spool.Write("epic", testBatch())
+	}()
+	<-sink.started
+
+	// The depth is read while the sink hangs
+	depth := make(chan SpoolDepth)
+	go func() {
+		depth <- spool.Depth()
+	}()
+	select {
+	case d := <-depth:
+		assert.Equal(SpoolDepth{}, d)
+	case <-time.After(time.Second):
+		assert.Fail("Depth is blocked by the write")
+	}
+
+	close(sink.release)
+	assert.Error(<-done)
+	assert.Equal(1, spool.Depth().Batches)
+}
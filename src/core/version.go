@@ -0,0 +1,4 @@
+package core
+
+// Version is the jerem version, set at compile time
+var Version = "dev"
@@ -5,6 +5,7 @@ go 1.12
 require (
 	github.com/PierreZ/Warp10Exporter v1.0.0
 	github.com/andygrunwald/go-jira v1.11.1
+	github.com/fsnotify/fsnotify v1.4.7
 	github.com/labstack/echo v3.3.10+incompatible
 	github.com/labstack/gommon v0.3.0 // indirect
 	github.com/sirupsen/logrus v1.4.2
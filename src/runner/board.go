@@ -0,0 +1,189 @@
+package runner
+
+import (
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+
+	warp "github.com/PierreZ/Warp10Exporter"
+	jira "github.com/andygrunwald/go-jira"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/ovh/jerem/src/core"
+)
+
+var boardPageSize = 100
+
+// boardSnapshots is the day of the last snapshot of each board, a board is
+// only collected once a day
+var boardSnapshots = struct {
+	sync.Mutex
+	days map[string]time.Time
+}{days: make(map[string]time.Time)}
+
+type boardIssues struct {
+	StartAt    int          `json:"startAt"`
+	MaxResults int          `json:"maxResults"`
+	Total      int          `json:"total"`
+	Issues     []jira.Issue `json:"issues"`
+}
+
+// BoardRunner runner handling board metrics, it counts the issues and story
+// points of each board column to build a cumulative flow diagram. As it
+// reads every board issue, it is disabled by default and each board is
+// collected once a day
+func BoardRunner(config core.Config, sink core.Sink) error {
+	if !config.Board.Enabled {
+		return nil
+	}
+
+	// A single snapshot per day
+	day := time.Now().UTC().Truncate(24 * time.Hour)
+
+	var projects []core.Project
+	for _, project := range config.Projects {
+		if !hasBoardSnapshot(project, day) {
+			projects = append(projects, project)
+		}
+	}
+	if len(projects) == 0 {
+		return nil
+	}
+
+	jiraClient, err := NewJiraClient(config.Jira)
+	if err != nil {
+		log.WithError(err).Error("Fail to get jira client")
+		return err
+	}
+
+	var collected []core.Project
+	var collectedMutex sync.Mutex
+	batch, failed := collectProjects(projects, config.Concurrency, func(project core.Project, batch *warp.Batch) error {
+		if err := processBoard(jiraClient, project, batch, day); err != nil {
+			return err
+		}
+		collectedMutex.Lock()
+		collected = append(collected, project)
+		collectedMutex.Unlock()
+		return nil
+	})
+
+	// The snapshots are only done once pushed, a failed push is retried on
+	// the next run
+	if err := pushBatch(sink, "board", batch); err != nil {
+		return runnerError(failed, err)
+	}
+	for _, project := range collected {
+		setBoardSnapshot(project, day)
+	}
+	return runnerError(failed, nil)
+}
+
+func getBoardSnapshotKey(project core.Project) string {
+	return fmt.Sprintf("%s|%s|%d", project.Name, project.Jql, project.Board)
+}
+
+// hasBoardSnapshot return true when the board was already collected that day
+func hasBoardSnapshot(project core.Project, day time.Time) bool {
+	boardSnapshots.Lock()
+	defer boardSnapshots.Unlock()
+	return boardSnapshots.days[getBoardSnapshotKey(project)].Equal(day)
+}
+
+func setBoardSnapshot(project core.Project, day time.Time) {
+	boardSnapshots.Lock()
+	defer boardSnapshots.Unlock()
+	boardSnapshots.days[getBoardSnapshotKey(project)] = day
+}
+
+func processBoard(jiraClient *jira.Client, project core.Project, batch *warp.Batch, day time.Time) error {
+	boardConfig, _, err := jiraClient.Board.GetBoardConfiguration(project.Board)
+	if err != nil {
+		log.WithField("project", project.Name).WithError(err).Warn("Fail to get board configuration")
+		return err
+	}
+
+	issues, err := getBoardIssues(jiraClient, project.Board, fmt.Sprintf("project = \"%s\" %s", project.Name, project.Jql), project.Fields.StoryPoint)
+	if err != nil {
+		log.WithField("project", project.Name).WithError(err).Warn("Fail to get board issues")
+		return err
+	}
+
+	counts, storyPoints := computeColumns(issues, boardConfig.ColumnConfig.Columns, project.Fields.StoryPoint)
+	for _, column := range boardConfig.ColumnConfig.Columns {
+		batch.Register(getBoardColumnMetric("count", project.Label, column.Name).AddDatapoint(day, counts[column.Name]))
+		batch.Register(getBoardColumnMetric("storypoint", project.Label, column.Name).AddDatapoint(day, storyPoints[column.Name]))
+	}
+
+	return nil
+}
+
+// getBoardIssues list the issues of a board matching the jql
+func getBoardIssues(jiraClient *jira.Client, boardID int, jql string, storyPointField string) ([]jira.Issue, error) {
+	var issues []jira.Issue
+	for {
+		apiEndpoint := fmt.Sprintf("rest/agile/1.0/board/%d/issue?jql=%s&fields=status,%s&startAt=%d&maxResults=%d", boardID, url.QueryEscape(jql), storyPointField, len(issues), boardPageSize)
+		req, err := jiraClient.NewRequest("GET", apiEndpoint, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		result := new(boardIssues)
+		resp, err := jiraClient.Do(req, result)
+		if err != nil {
+			return nil, jira.NewJiraError(resp, err)
+		}
+
+		issues = append(issues, result.Issues...)
+		if len(result.Issues) == 0 || len(issues) >= result.Total {
+			return issues, nil
+		}
+	}
+}
+
+// computeColumns count the issues and story points of each column, issues
+// with a status not mapped to a column are not displayed on the board and
+// are ignored
+func computeColumns(issues []jira.Issue, columns []jira.BoardConfigurationColumn, storyPointField string) (map[string]int, map[string]float64) {
+	statusColumns := getStatusColumns(columns)
+
+	counts := make(map[string]int)
+	storyPoints := make(map[string]float64)
+	for _, issue := range issues {
+		if issue.Fields == nil || issue.Fields.Status == nil {
+			continue
+		}
+		column, ok := statusColumns[issue.Fields.Status.ID]
+		if !ok {
+			continue
+		}
+
+		sp, err := getStoryPoints(storyPointField, issue)
+		if err != nil {
+			log.WithField("key", issue.Key).WithError(err).Warn("Fail to get story points")
+		}
+		counts[column]++
+		storyPoints[column] += sp
+	}
+
+	return counts, storyPoints
+}
+
+// getStatusColumns map the status ids to their board column name
+func getStatusColumns(columns []jira.BoardConfigurationColumn) map[string]string {
+	statusColumns := make(map[string]string)
+	for _, column := range columns {
+		for _, status := range column.Status {
+			statusColumns[status.ID] = column.Name
+		}
+	}
+	return statusColumns
+}
+
+func getBoardColumnMetric(name, projectLabel, column string) *warp.GTS {
+	return warp.NewGTS(fmt.Sprintf("jerem.jira.board.column.%s", name)).WithLabels(warp.Labels{
+		"project": projectLabel,
+		"column":  column,
+	})
+}
@@ -0,0 +1,128 @@
+package runner
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	warp "github.com/PierreZ/Warp10Exporter"
+	jira "github.com/andygrunwald/go-jira"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ovh/jerem/src/core"
+)
+
+func boardIssue(status string, storyPoints float64) jira.Issue {
+	return jira.Issue{
+		Fields: &jira.IssueFields{
+			Status:   &jira.Status{ID: status},
+			Unknowns: map[string]interface{}{"customfield_10006": storyPoints},
+		},
+	}
+}
+
+// flakySink fail to write until it is told to succeed, and keep the last
+// written batch
+type flakySink struct {
+	fail    bool
+	batches int
+	last    *warp.Batch
+}
+
+func (f *flakySink) Name() string {
+	return "flaky"
+}
+
+func (f *flakySink) Write(runner string, batch *warp.Batch) error {
+	if f.fail {
+		return fmt.Errorf("unavailable")
+	}
+	f.batches++
+	f.last = batch
+	return nil
+}
+
+func TestComputeColumns(t *testing.T) {
+	assert := require.New(t)
+
+	columns := []jira.BoardConfigurationColumn{
+		{Name: "To Do", Status: []jira.BoardConfigurationColumnStatus{{ID: "1"}}},
+		{Name: "In Progress", Status: []jira.BoardConfigurationColumnStatus{{ID: "3"}, {ID: "4"}}},
+		{Name: "Done", Status: []jira.BoardConfigurationColumnStatus{{ID: "5"}}},
+	}
+	issues := []jira.Issue{
+		boardIssue("1", 3),
+		boardIssue("3", 5),
+		boardIssue("4", 2),
+		boardIssue("5", 8),
+		// Not mapped to a column
+		boardIssue("6", 13),
+	}
+
+	counts, storyPoints := computeColumns(issues, columns, "customfield_10006")
+	assert.Equal(map[string]int{"To Do": 1, "In Progress": 2, "Done": 1}, counts)
+	assert.Equal(map[string]float64{"To Do": 3, "In Progress": 7, "Done": 8}, storyPoints)
+}
+
+func TestBoardSnapshot(t *testing.T) {
+	assert := require.New(t)
+
+	// Snapshots are kept between runs, start from none
+	boardSnapshots.Lock()
+	boardSnapshots.days = make(map[string]time.Time)
+	boardSnapshots.Unlock()
+
+	project := core.Project{Name: "PJ1", Board: 1}
+	day := time.Date(2020, time.June, 1, 0, 0, 0, 0, time.UTC)
+
+	assert.False(hasBoardSnapshot(project, day))
+	setBoardSnapshot(project, day)
+	assert.True(hasBoardSnapshot(project, day))
+	assert.False(hasBoardSnapshot(core.Project{Name: "PJ1", Board: 2}, day))
+	assert.False(hasBoardSnapshot(project, day.Add(24*time.Hour)))
+
+	// The board runner is disabled by default, jira isn't requested
+	assert.NoError(BoardRunner(core.Config{Projects: []core.Project{project}}, nil))
+}
+
+func TestBoardRunnerPushFailure(t *testing.T) {
+	assert := require.New(t)
+
+	boardSnapshots.Lock()
+	boardSnapshots.days = make(map[string]time.Time)
+	boardSnapshots.Unlock()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/rest/agile/1.0/board/5/configuration", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"id": 5, "columnConfig": {"columns": [{"name": "To Do", "statuses": [{"id": "1"}]}]}}`))
+	})
+	mux.HandleFunc("/rest/agile/1.0/board/5/issue", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"startAt": 0, "maxResults": 50, "total": 1, "issues": [{"key": "PJ1-1", "fields": {"status": {"id": "1"}}}]}`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	project := core.Project{Name: "PJ1", Label: "PJ1", Board: 5}
+	config := core.Config{
+		Jira:     core.Jira{Auth: core.Auth{Type: core.AuthBasic}, URL: server.URL},
+		Projects: []core.Project{project},
+		Board:    core.Board{Enabled: true},
+	}
+	day := time.Now().UTC().Truncate(24 * time.Hour)
+
+	// A failed push doesn't mark the day as collected
+	sink := &flakySink{fail: true}
+	assert.Error(BoardRunner(config, sink))
+	assert.False(hasBoardSnapshot(project, day))
+
+	sink.fail = false
+	assert.NoError(BoardRunner(config, sink))
+	assert.True(hasBoardSnapshot(project, day))
+	assert.Equal(1, sink.batches)
+
+	// The day is only collected once
+	assert.NoError(BoardRunner(config, sink))
+	assert.Equal(1, sink.batches)
+}
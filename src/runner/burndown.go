@@ -0,0 +1,138 @@
+package runner
+
+import (
+	"strings"
+	"time"
+
+	warp "github.com/PierreZ/Warp10Exporter"
+	jira "github.com/andygrunwald/go-jira"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/ovh/jerem/src/core"
+)
+
+// timePoint is a value at a date, like the story points remaining in a
+// sprint
+type timePoint struct {
+	At    time.Time
+	Value float64
+}
+
+// getBurndownDates return the sprint start and each following midnight, up
+// to the given date
+func getBurndownDates(start, last time.Time) []time.Time {
+	dates := []time.Time{start}
+	for day := start.UTC().Truncate(24 * time.Hour).Add(24 * time.Hour); !day.After(last); day = day.Add(24 * time.Hour) {
+		dates = append(dates, day)
+	}
+	return dates
+}
+
+// computeBurndown replay the issues changelog to compute the story points
+// remaining in the sprint at its start and at each midnight until now.
+// issues are in the sprint, others may have been removed from it
+func computeBurndown(issues, others []jira.Issue, sprint jira.Sprint, categories map[string]string, storyPointField string, now time.Time) []timePoint {
+	last := now
+	if sprint.EndDate.Before(last) {
+		last = *sprint.EndDate
+	}
+
+	dates := getBurndownDates(*sprint.StartDate, last)
+	points := make([]timePoint, len(dates))
+	for i, at := range dates {
+		points[i].At = at
+	}
+
+	walk := func(issue jira.Issue, inSprint bool) {
+		changes := getSprintChanges(issue, sprint.ID)
+		if !inSprint && len(changes) == 0 {
+			return
+		}
+
+		sp, err := getStoryPoints(storyPointField, issue)
+		if err != nil {
+			log.WithField("key", issue.Key).WithError(err).Warn("Fail to get story points")
+			return
+		}
+		if sp == 0 {
+			return
+		}
+
+		transitions := getStatusTransitions(issue)
+		for i, at := range dates {
+			if !isInSprintAt(issue, changes, inSprint, at) {
+				continue
+			}
+			if categories[strings.ToLower(getStatusAt(issue, transitions, at))] == "done" {
+				continue
+			}
+			points[i].Value += sp
+		}
+	}
+
+	for _, issue := range issues {
+		walk(issue, true)
+	}
+	for _, issue := range others {
+		walk(issue, false)
+	}
+
+	return points
+}
+
+// computeIdealBurndown burn the committed story points evenly over the
+// sprint working days, the ideal burndown is flat on non working days
+func computeIdealBurndown(sprint jira.Sprint, committed float64, burndown core.Burndown) []timePoint {
+	start, end := *sprint.StartDate, *sprint.EndDate
+
+	var workingDays []time.Time
+	for day := start.UTC().Truncate(24 * time.Hour); day.Before(end); day = day.Add(24 * time.Hour) {
+		if burndown.IsWorkingDay(day) {
+			workingDays = append(workingDays, day)
+		}
+	}
+
+	dates := getBurndownDates(start, end)
+	if dates[len(dates)-1].Before(end) {
+		dates = append(dates, end)
+	}
+
+	points := make([]timePoint, len(dates))
+	for i, at := range dates {
+		points[i].At = at
+		if i == len(dates)-1 || len(workingDays) == 0 {
+			continue
+		}
+
+		// Working days elapsed at this date
+		worked := 0
+		for _, day := range workingDays {
+			if !day.Add(24 * time.Hour).After(at) {
+				worked++
+			}
+		}
+		points[i].Value = committed * float64(len(workingDays)-worked) / float64(len(workingDays))
+	}
+	points[len(points)-1].Value = 0
+
+	return points
+}
+
+// registerBurndown register the remaining and ideal burndown series
+func registerBurndown(batch *warp.Batch, remaining, ideal []timePoint, projectLabel, sprint string) {
+	gts := getSprintMetric("burndown.remaining", projectLabel, sprint)
+	for _, point := range remaining {
+		gts.AddDatapoint(point.At, point.Value)
+	}
+	if len(gts.Datapoints) > 0 {
+		batch.Register(gts)
+	}
+
+	gts = getSprintMetric("burndown.ideal", projectLabel, sprint)
+	for _, point := range ideal {
+		gts.AddDatapoint(point.At, point.Value)
+	}
+	if len(gts.Datapoints) > 0 {
+		batch.Register(gts)
+	}
+}
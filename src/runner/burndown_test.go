@@ -0,0 +1,64 @@
+package runner
+
+import (
+	"testing"
+	"time"
+
+	jira "github.com/andygrunwald/go-jira"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ovh/jerem/src/core"
+)
+
+func timePointValues(points []timePoint) []float64 {
+	var values []float64
+	for _, point := range points {
+		values = append(values, point.Value)
+	}
+	return values
+}
+
+func TestComputeBurndown(t *testing.T) {
+	assert := require.New(t)
+
+	start := time.Date(2020, 1, 6, 9, 0, 0, 0, time.UTC)
+	end := time.Date(2020, 1, 17, 18, 0, 0, 0, time.UTC)
+	sprint := jira.Sprint{ID: 12, StartDate: &start, EndDate: &end}
+
+	created := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	issues := []jira.Issue{
+		// Done during the sprint
+		velocityIssue(created, 3, statusChange("2020-01-07T15:00:00.000+0000", "To Do", "Done")),
+		// Still to do
+		velocityIssue(created, 5),
+		// Added during the sprint
+		velocityIssue(created, 2, sprintFieldChange("2020-01-08T10:00:00.000+0000", "", "12")),
+	}
+	others := []jira.Issue{
+		// Removed during the sprint
+		velocityIssue(created, 8,
+			sprintFieldChange("2020-01-03T00:00:00.000+0000", "", "12"),
+			sprintFieldChange("2020-01-08T12:00:00.000+0000", "12", ""),
+		),
+	}
+
+	now := time.Date(2020, 1, 9, 12, 0, 0, 0, time.UTC)
+	points := computeBurndown(issues, others, sprint, flowCategories, "customfield_10006", now)
+	assert.Len(points, 4)
+	assert.Equal(start, points[0].At)
+	assert.Equal(time.Date(2020, 1, 9, 0, 0, 0, 0, time.UTC), points[3].At)
+	assert.Equal([]float64{16, 16, 13, 7}, timePointValues(points))
+}
+
+func TestComputeIdealBurndown(t *testing.T) {
+	assert := require.New(t)
+
+	start := time.Date(2020, 1, 6, 9, 0, 0, 0, time.UTC)
+	end := time.Date(2020, 1, 17, 18, 0, 0, 0, time.UTC)
+	sprint := jira.Sprint{ID: 12, StartDate: &start, EndDate: &end}
+	burndown := core.Burndown{NonWorkingDays: []time.Weekday{time.Saturday, time.Sunday}}
+
+	points := computeIdealBurndown(sprint, 20, burndown)
+	assert.Equal(end, points[len(points)-1].At)
+	assert.Equal([]float64{20, 18, 16, 14, 12, 10, 10, 10, 8, 6, 4, 2, 0}, timePointValues(points))
+}
@@ -0,0 +1,396 @@
+package runner
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"io/ioutil"
+	mathrand "math/rand"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	jira "github.com/andygrunwald/go-jira"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/ovh/jerem/src/core"
+)
+
+// NewJiraClient create a jira client authenticated as configured
+func NewJiraClient(config core.Jira) (*jira.Client, error) {
+	var client *http.Client
+	switch config.Auth.Type {
+	case core.AuthBasic:
+		tp := jira.BasicAuthTransport{
+			Username: config.Username,
+			Password: config.Password.Value(),
+		}
+		client = tp.Client()
+
+	case core.AuthBearer:
+		tp := bearerTransport{Token: config.Auth.Token.Value()}
+		client = &http.Client{Transport: &tp}
+
+	case core.AuthOAuth1:
+		key, err := loadPrivateKey(config.Auth.PrivateKey)
+		if err != nil {
+			return nil, err
+		}
+		tp := oauth1Transport{
+			ConsumerKey: config.Auth.ConsumerKey,
+			Token:       config.Auth.Token.Value(),
+			PrivateKey:  key,
+		}
+		client = &http.Client{Transport: &tp}
+
+	default:
+		return nil, fmt.Errorf("unknown jira auth type '%s'", config.Auth.Type)
+	}
+
+	if config.RateLimit > 0 {
+		client.Transport = &limitTransport{
+			Transport: client.Transport,
+			Limiter:   getRateLimiter(config.URL, config.RateLimit),
+		}
+	}
+
+	// Each attempt waits for the rate limiter
+	client.Transport = &retryTransport{
+		Transport: client.Transport,
+		Retry:     config.Retry,
+		Timeout:   config.Timeout,
+	}
+
+	return jira.NewClient(client, config.URL)
+}
+
+// rateLimiters are shared by the clients of a jira, so the limit holds for
+// all the runners and their concurrent projects
+var rateLimiters = struct {
+	sync.Mutex
+	limiters map[string]*rateLimiter
+}{limiters: make(map[string]*rateLimiter)}
+
+func getRateLimiter(url string, rate float64) *rateLimiter {
+	rateLimiters.Lock()
+	defer rateLimiters.Unlock()
+
+	key := fmt.Sprintf("%s|%v", url, rate)
+	limiter, ok := rateLimiters.limiters[key]
+	if !ok {
+		limiter = newRateLimiter(rate)
+		rateLimiters.limiters[key] = limiter
+	}
+	return limiter
+}
+
+// rateLimiter space out requests to allow at most rate requests per second
+type rateLimiter struct {
+	mutex    sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+func newRateLimiter(rate float64) *rateLimiter {
+	return &rateLimiter{interval: time.Duration(float64(time.Second) / rate)}
+}
+
+// reserve return the delay to wait before sending a request
+func (l *rateLimiter) reserve(now time.Time) time.Duration {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.next.Before(now) {
+		l.next = now
+	}
+	delay := l.next.Sub(now)
+	l.next = l.next.Add(l.interval)
+	return delay
+}
+
+// limitTransport wait for the rate limiter before each request
+type limitTransport struct {
+	Transport http.RoundTripper
+	Limiter   *rateLimiter
+}
+
+func (t *limitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if delay := t.Limiter.reserve(time.Now()); delay > 0 {
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		}
+	}
+
+	transport := t.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	return transport.RoundTrip(req)
+}
+
+// retryTransport retry the requests failing with a 429 or 5xx status or a
+// transport error, with an exponential backoff or the delay of the
+// Retry-After header. Each attempt is bounded by the timeout
+type retryTransport struct {
+	Transport http.RoundTripper
+	Retry     core.Retry
+	Timeout   time.Duration
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	transport := t.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	for attempt := 0; ; attempt++ {
+		req2, err := rewindRequest(req, attempt)
+		if err != nil {
+			return nil, err
+		}
+
+		var cancel context.CancelFunc = func() {}
+		if t.Timeout > 0 {
+			var ctx context.Context
+			ctx, cancel = context.WithTimeout(req.Context(), t.Timeout)
+			req2 = req2.WithContext(ctx)
+		}
+
+		resp, err := transport.RoundTrip(req2)
+
+		// Retry transient failures, unless the request is replayed too many
+		// times, has a body which can't be replayed or was canceled
+		retry := err != nil || resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= http.StatusInternalServerError
+		if !retry || attempt >= t.Retry.Max || (req.Body != nil && req.GetBody == nil) || req.Context().Err() != nil {
+			if err != nil {
+				cancel()
+				return nil, err
+			}
+			resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: cancel}
+			return resp, nil
+		}
+
+		delay := getBackoff(t.Retry, attempt)
+		entry := log.WithFields(log.Fields{"url": req.URL.String(), "attempt": attempt + 1})
+		if err != nil {
+			entry = entry.WithError(err)
+		} else {
+			if after, ok := getRetryAfter(resp.Header.Get("Retry-After"), time.Now()); ok {
+				delay = after
+			}
+			entry = entry.WithField("status", resp.StatusCode)
+			io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		cancel()
+		entry.WithField("delay", delay).Warn("Jira request failed, retrying")
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		}
+	}
+}
+
+// rewindRequest return the request to send for an attempt, with a fresh
+// body after the first one
+func rewindRequest(req *http.Request, attempt int) (*http.Request, error) {
+	if attempt == 0 || req.Body == nil || req.GetBody == nil {
+		return req, nil
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, err
+	}
+	req2 := new(http.Request)
+	*req2 = *req
+	req2.Body = body
+	return req2, nil
+}
+
+// getBackoff return the delay before a retry, doubled at each attempt up to
+// the max backoff, with a random jitter of up to half the delay
+func getBackoff(retry core.Retry, attempt int) time.Duration {
+	delay := retry.Backoff
+	for i := 0; i < attempt && delay < retry.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > retry.MaxBackoff {
+		delay = retry.MaxBackoff
+	}
+	return delay/2 + time.Duration(mathrand.Int63n(int64(delay/2)+1))
+}
+
+// getRetryAfter parse a Retry-After header, either seconds or a http date
+func getRetryAfter(header string, now time.Time) (time.Duration, bool) {
+	if header == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(strings.TrimSpace(header)); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(header); err == nil {
+		if delay := date.Sub(now); delay > 0 {
+			return delay, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// cancelBody release the attempt context once the response body is closed
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// bearerTransport authenticate requests with a personal access token
+type bearerTransport struct {
+	Token string
+}
+
+func (t *bearerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req2 := cloneRequest(req)
+	req2.Header.Set("Authorization", fmt.Sprintf("Bearer %s", t.Token))
+	return http.DefaultTransport.RoundTrip(req2)
+}
+
+// oauth1Transport sign requests with OAuth 1.0a RSA-SHA1, as expected by
+// jira application links
+type oauth1Transport struct {
+	ConsumerKey string
+	Token       string
+	PrivateKey  *rsa.PrivateKey
+}
+
+func (t *oauth1Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	params := map[string]string{
+		"oauth_consumer_key":     t.ConsumerKey,
+		"oauth_nonce":            fmt.Sprintf("%x", nonce),
+		"oauth_signature_method": "RSA-SHA1",
+		"oauth_timestamp":        strconv.FormatInt(time.Now().Unix(), 10),
+		"oauth_token":            t.Token,
+		"oauth_version":          "1.0",
+	}
+
+	signature, err := oauth1Signature(t.PrivateKey, req.Method, req.URL, params)
+	if err != nil {
+		return nil, err
+	}
+	params["oauth_signature"] = signature
+
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var header []string
+	for _, key := range keys {
+		header = append(header, fmt.Sprintf("%s=\"%s\"", oauth1Escape(key), oauth1Escape(params[key])))
+	}
+
+	req2 := cloneRequest(req)
+	req2.Header.Set("Authorization", fmt.Sprintf("OAuth %s", strings.Join(header, ", ")))
+	return http.DefaultTransport.RoundTrip(req2)
+}
+
+// oauth1Signature sign the request base string, see RFC 5849 section 3.4
+func oauth1Signature(key *rsa.PrivateKey, method string, u *url.URL, oauthParams map[string]string) (string, error) {
+	var params []string
+	for key, values := range u.Query() {
+		for _, value := range values {
+			params = append(params, fmt.Sprintf("%s=%s", oauth1Escape(key), oauth1Escape(value)))
+		}
+	}
+	for key, value := range oauthParams {
+		params = append(params, fmt.Sprintf("%s=%s", oauth1Escape(key), oauth1Escape(value)))
+	}
+	sort.Strings(params)
+
+	baseURL := fmt.Sprintf("%s://%s%s", strings.ToLower(u.Scheme), strings.ToLower(u.Host), u.EscapedPath())
+	base := strings.Join([]string{
+		strings.ToUpper(method),
+		oauth1Escape(baseURL),
+		oauth1Escape(strings.Join(params, "&")),
+	}, "&")
+
+	hash := sha1.Sum([]byte(base))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA1, hash[:])
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(signature), nil
+}
+
+// oauth1Escape percent encode a value, only unreserved characters are kept
+func oauth1Escape(s string) string {
+	return strings.Replace(url.QueryEscape(s), "+", "%20", -1)
+}
+
+func loadPrivateKey(path string) (*rsa.PrivateKey, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("fail to read jira private key: %s", err)
+	}
+
+	block, _ := pem.Decode(content)
+	if block == nil {
+		return nil, fmt.Errorf("jira private key %s should be PEM encoded", path)
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("fail to parse jira private key: %s", err)
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("jira private key %s should be a RSA key", path)
+	}
+	return rsaKey, nil
+}
+
+// cloneRequest return a shallow copy of the request with its own headers,
+// a RoundTripper must not modify the original request
+func cloneRequest(req *http.Request) *http.Request {
+	req2 := new(http.Request)
+	*req2 = *req
+	req2.Header = make(http.Header, len(req.Header))
+	for key, values := range req.Header {
+		req2.Header[key] = append([]string(nil), values...)
+	}
+	return req2
+}
@@ -0,0 +1,208 @@
+package runner
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ovh/jerem/src/core"
+)
+
+func TestBearerClient(t *testing.T) {
+	assert := require.New(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal("Bearer mytoken", r.Header.Get("Authorization"))
+		w.Write([]byte(`[]`))
+	}))
+	defer server.Close()
+
+	jiraClient, err := NewJiraClient(core.Jira{URL: server.URL, Auth: core.Auth{Type: core.AuthBearer, Token: "mytoken"}})
+	assert.NoError(err)
+
+	_, _, err = jiraClient.Field.GetList()
+	assert.NoError(err)
+}
+
+func TestOAuth1Client(t *testing.T) {
+	assert := require.New(t)
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(err)
+
+	dir, err := ioutil.TempDir("", "jerem")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "jira.pem")
+	assert.NoError(ioutil.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}), 0600))
+
+	var header string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header.Get("Authorization")
+		w.Write([]byte(`[]`))
+	}))
+	defer server.Close()
+
+	jiraClient, err := NewJiraClient(core.Jira{URL: server.URL, Auth: core.Auth{Type: core.AuthOAuth1, ConsumerKey: "jerem", Token: "access", PrivateKey: path}})
+	assert.NoError(err)
+
+	_, _, err = jiraClient.Field.GetList()
+	assert.NoError(err)
+	assert.True(strings.HasPrefix(header, "OAuth "))
+
+	// Rebuild the signature base string from the header and check the signature
+	var params []string
+	var signature []byte
+	for _, param := range strings.Split(strings.TrimPrefix(header, "OAuth "), ", ") {
+		kv := strings.SplitN(param, "=", 2)
+		value, err := url.QueryUnescape(strings.Trim(kv[1], `"`))
+		assert.NoError(err)
+
+		if kv[0] == "oauth_signature" {
+			signature, err = base64.StdEncoding.DecodeString(value)
+			assert.NoError(err)
+			continue
+		}
+		params = append(params, fmt.Sprintf("%s=%s", kv[0], oauth1Escape(value)))
+	}
+	sort.Strings(params)
+	assert.Contains(params, "oauth_consumer_key=jerem")
+	assert.Contains(params, "oauth_token=access")
+	assert.Contains(params, "oauth_signature_method=RSA-SHA1")
+
+	base := strings.Join([]string{"GET", oauth1Escape(server.URL + "/rest/api/2/field"), oauth1Escape(strings.Join(params, "&"))}, "&")
+	hash := sha1.Sum([]byte(base))
+	assert.NoError(rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA1, hash[:], signature))
+}
+
+func TestUnknownPrivateKey(t *testing.T) {
+	assert := require.New(t)
+
+	_, err := NewJiraClient(core.Jira{Auth: core.Auth{Type: core.AuthOAuth1, PrivateKey: "/nonexistent/jira.pem"}})
+	assert.Error(err)
+}
+func TestRateLimiter(t *testing.T) {
+	assert := require.New(t)
+
+	limiter := newRateLimiter(4)
+	now := time.Now()
+	assert.Equal(time.Duration(0), limiter.reserve(now))
+	assert.Equal(250*time.Millisecond, limiter.reserve(now))
+	assert.Equal(500*time.Millisecond, limiter.reserve(now))
+
+	// Unused slots are not accumulated
+	assert.Equal(time.Duration(0), limiter.reserve(now.Add(time.Second)))
+	assert.Equal(250*time.Millisecond, limiter.reserve(now.Add(time.Second)))
+
+	// Clients of a jira share their limiter
+	assert.True(getRateLimiter("https://jira.com", 4) == getRateLimiter("https://jira.com", 4))
+	assert.False(getRateLimiter("https://jira.com", 4) == getRateLimiter("https://jira.org", 4))
+}
+func TestRetryClient(t *testing.T) {
+	assert := require.New(t)
+
+	var attempts int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/rest/api/2/serverInfo", func(w http.ResponseWriter, r *http.Request) {
+		switch atomic.AddInt32(&attempts, 1) {
+		case 1:
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+		case 2:
+			w.WriteHeader(http.StatusBadGateway)
+		default:
+			w.Write([]byte(`{"deploymentType": "Cloud"}`))
+		}
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	retry := core.Retry{Max: 2, Backoff: time.Millisecond, MaxBackoff: 10 * time.Millisecond}
+	jiraClient, err := NewJiraClient(core.Jira{Auth: core.Auth{Type: core.AuthBasic}, URL: server.URL, Retry: retry, Timeout: time.Second})
+	assert.NoError(err)
+
+	strategy, err := detectEpicChildren(jiraClient)
+	assert.NoError(err)
+	assert.Equal(core.EpicChildrenParent, strategy)
+	assert.Equal(int32(3), atomic.LoadInt32(&attempts))
+
+	// The last failure is returned once the retries are exhausted
+	atomic.StoreInt32(&attempts, 0)
+	retry.Max = 1
+	jiraClient, err = NewJiraClient(core.Jira{Auth: core.Auth{Type: core.AuthBasic}, URL: server.URL, Retry: retry, Timeout: time.Second})
+	assert.NoError(err)
+
+	_, err = detectEpicChildren(jiraClient)
+	assert.Error(err)
+	assert.Equal(int32(2), atomic.LoadInt32(&attempts))
+}
+func TestRetryTimeout(t *testing.T) {
+	assert := require.New(t)
+
+	var attempts int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/rest/api/2/serverInfo", func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&attempts, 1) == 1 {
+			time.Sleep(200 * time.Millisecond)
+		}
+		w.Write([]byte(`{"deploymentType": "Server"}`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	retry := core.Retry{Max: 1, Backoff: time.Millisecond, MaxBackoff: time.Millisecond}
+	jiraClient, err := NewJiraClient(core.Jira{Auth: core.Auth{Type: core.AuthBasic}, URL: server.URL, Retry: retry, Timeout: 50 * time.Millisecond})
+	assert.NoError(err)
+
+	strategy, err := detectEpicChildren(jiraClient)
+	assert.NoError(err)
+	assert.Equal(core.EpicChildrenEpicLink, strategy)
+	assert.Equal(int32(2), atomic.LoadInt32(&attempts))
+}
+func TestGetBackoff(t *testing.T) {
+	assert := require.New(t)
+
+	retry := core.Retry{Backoff: time.Second, MaxBackoff: 5 * time.Second}
+	for attempt, max := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second} {
+		delay := getBackoff(retry, attempt)
+		assert.True(delay >= max/2 && delay <= max, "attempt %d delay %s", attempt, delay)
+	}
+}
+func TestGetRetryAfter(t *testing.T) {
+	assert := require.New(t)
+
+	now := time.Date(2020, time.June, 1, 12, 0, 0, 0, time.UTC)
+
+	delay, ok := getRetryAfter("", now)
+	assert.False(ok)
+
+	delay, ok = getRetryAfter("120", now)
+	assert.True(ok)
+	assert.Equal(2*time.Minute, delay)
+
+	delay, ok = getRetryAfter(now.Add(time.Minute).Format(http.TimeFormat), now)
+	assert.True(ok)
+	assert.Equal(time.Minute, delay)
+
+	_, ok = getRetryAfter("soon", now)
+	assert.False(ok)
+}
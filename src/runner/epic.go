@@ -1,10 +1,9 @@
 package runner
 
 import (
-	"bytes"
 	"fmt"
-	"regexp"
 	"strings"
+	"sync"
 	"time"
 
 	warp "github.com/PierreZ/Warp10Exporter"
@@ -14,78 +13,150 @@ import (
 	"github.com/ovh/jerem/src/core"
 )
 
-const storyPointField = "customfield_10006"
+// epicChildrenChunk is the number of epics whose children are searched in
+// a single JQL query
+const epicChildrenChunk = 50
 
-var quarterRegex = regexp.MustCompile(`^Q[1-4]-\d{2}$`)
-var projectPrefix = "Project_"
+// epicLinkName is the display name of the Epic Link custom field
+const epicLinkName = "Epic Link"
 
-// EpicRunner runner handling epic metrics
-func EpicRunner(config core.Config) {
-	tp := jira.BasicAuthTransport{
-		Username: config.Jira.Username,
-		Password: config.Jira.Password,
-	}
-	jiraClient, err := jira.NewClient(tp.Client(), config.Jira.URL)
+type serverInfo struct {
+	DeploymentType string `json:"deploymentType"`
+}
+
+// EpicRunner runner handling epic metrics, it returns an error when a
+// project couldn't be collected or the metrics couldn't be pushed
+func EpicRunner(config core.Config, sink core.Sink) error {
+	jiraClient, err := NewJiraClient(config.Jira)
 	if err != nil {
 		log.WithError(err).Error("Fail to get jira client")
-		return
+		return err
 	}
 
-	batch := warp.NewBatch()
+	// Epics story points per initiative key, an epic may be collected by
+	// several projects
+	initiatives := make(map[string]map[string]epicPoints)
+	var initiativesMutex sync.Mutex
 
-	// Get epics per project
-	for _, project := range config.Projects {
-		epics, err := getEpics(jiraClient, project)
-		if err != nil {
-			log.WithError(err).Error("Fail to get jira epics")
-			continue
+	batch, failed := collectProjects(config.Projects, config.Concurrency, func(project core.Project, batch *warp.Batch) error {
+		projectInitiatives, err := processEpicProject(jiraClient, project, config.Dimensions, config.Concurrency, batch)
+
+		initiativesMutex.Lock()
+		defer initiativesMutex.Unlock()
+		for parent, epics := range projectInitiatives {
+			if initiatives[parent] == nil {
+				initiatives[parent] = make(map[string]epicPoints)
+			}
+			for key, points := range epics {
+				initiatives[parent][key] = points
+			}
 		}
+		return err
+	})
 
-		// Count storypoints per epic
-		for _, epic := range epics {
+	// Initiatives and themes sum the epics of every project, partial sums
+	// would overwrite their totals
+	switch {
+	case len(initiatives) == 0:
+	case config.Partial:
+		log.Info("Only some projects are collected, skipping the initiatives")
+	case len(failed) > 0:
+		log.WithField("failed", failed).Warn("Some projects couldn't be collected, skipping the initiatives")
+	default:
+		if err := processInitiatives(jiraClient, initiatives, getParentFields(config.Projects), config.Concurrency, batch); err != nil {
+			failed = append(failed, "initiatives")
+		}
+	}
 
-			status := getStatus(epic) // [undefined, new, indeterminate, done]
+	return runnerError(failed, pushBatch(sink, "epic", batch))
+}
 
-			if status == jira.StatusCategoryComplete {
-				continue
-			}
+// getParentFields return the parent link fields of the projects, read to
+// follow the initiatives to their theme
+func getParentFields(projects []core.Project) []string {
+	var fields []string
+	seen := make(map[string]bool)
+	for _, project := range projects {
+		field := project.Fields.ParentLink
+		if field != "" && !seen[field] {
+			seen[field] = true
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
 
-			// Get global project related to current epic
-			global := "None"
-			for _, label := range epic.Fields.Labels {
-				if strings.HasPrefix(label, projectPrefix) {
-					global = strings.TrimLeft(label, projectPrefix)
-				}
-			}
+// processEpicProject register the series of the project epics and return
+// their story points per initiative key
+func processEpicProject(jiraClient *jira.Client, project core.Project, dimensions []core.Dimension, concurrency int, batch *warp.Batch) (map[string]map[string]epicPoints, error) {
+	epics, err := getEpics(jiraClient, project)
+	if err != nil {
+		log.WithError(err).Error("Fail to get jira epics")
+		return nil, err
+	}
 
-			// Search for quarter label
-			for _, label := range epic.Fields.Labels {
-				if quarterRegex.MatchString(label) {
-					processEpic(jiraClient, epic, label, project.Label, global, batch)
-				}
+	// Select the epics to collect, with their periods and initiative
+	var selected []jira.Issue
+	periods := make(map[string][]string)
+	parents := make(map[string]string)
+	for _, epic := range epics {
+		parent := getParentLink(epic, project.Fields.ParentLink)
 
-			}
+		// Search for period labels, done epics are only collected for
+		// their initiative
+		var epicPeriods []string
+		status := getStatus(epic) // [undefined, new, indeterminate, done]
+		if status != jira.StatusCategoryComplete {
+			epicPeriods = getEpicPeriods(epic, project.Periods)
+		}
+		if len(epicPeriods) == 0 && parent == "" {
+			continue
 		}
 
+		selected = append(selected, epic)
+		periods[epic.Key] = epicPeriods
+		parents[epic.Key] = parent
 	}
 
-	var b bytes.Buffer
-	batch.Print(&b)
-	log.Debug(b.String())
-	if len(*batch) != 0 {
-		err = batch.Push(config.Metrics.URL, config.Metrics.Token)
-		if err != nil {
-			log.WithError(err).Error("Fail to push metrics")
+	// Children of the epics, an epic is missing when its children
+	// couldn't be fetched
+	children, err := getEpicsChildren(jiraClient, project, selected, concurrency)
+
+	// Count storypoints per epic
+	initiatives := make(map[string]map[string]epicPoints)
+	for _, epic := range selected {
+		issues, ok := children[epic.Key]
+		if !ok {
+			continue
+		}
+
+		// Get the dimensions of the current epic, like its global project
+		epicDimensions := getEpicDimensions(epic, dimensions)
+
+		points := processEpic(issues, epic, periods[epic.Key], project, epicDimensions, batch)
+
+		if parent := parents[epic.Key]; parent != "" {
+			if initiatives[parent] == nil {
+				initiatives[parent] = make(map[string]epicPoints)
+			}
+			initiatives[parent][epic.Key] = points
 		}
 	}
+
+	return initiatives, err
 }
 
 func getEpics(jiraClient *jira.Client, project core.Project) ([]jira.Issue, error) {
 	query := getEpicQuery(project)
 
+	fields := []string{"id", "key", "project", "labels", "summary", "status", "duedate", "fixVersions"}
+	if project.Fields.ParentLink != "" {
+		fields = append(fields, project.Fields.ParentLink)
+	}
+
 	var epics []jira.Issue
 	err := jiraClient.Issue.SearchPages(query, &jira.SearchOptions{
-		Fields: []string{"id", "key", "project", "labels", "summary", "status"},
+		Fields: fields,
 	}, func(issue jira.Issue) error {
 		epics = append(epics, issue)
 		return nil
@@ -98,37 +169,181 @@ func getEpics(jiraClient *jira.Client, project core.Project) ([]jira.Issue, erro
 	return epics, nil
 }
 
+// getEpicPeriods return the planning periods of an epic from its labels,
+// or from its due date or fix versions when no label match
+func getEpicPeriods(epic jira.Issue, periods core.Periods) []string {
+	var res []string
+	for _, label := range epic.Fields.Labels {
+		if period, ok := periods.Match(label); ok {
+			res = append(res, period)
+		}
+	}
+	if len(res) > 0 {
+		return res
+	}
+
+	switch periods.Fallback {
+	case core.PeriodFallbackDueDate:
+		if due := time.Time(epic.Fields.Duedate); !due.IsZero() {
+			res = append(res, periods.Of(due))
+		}
+	case core.PeriodFallbackFixVersion:
+		for _, version := range epic.Fields.FixVersions {
+			// Versions not matching a period are ignored, like labels
+			if period, ok := periods.Match(version.Name); ok {
+				res = append(res, period)
+			}
+		}
+	}
+	return res
+}
+
 func getEpicQuery(project core.Project) string {
-	return fmt.Sprintf("(project = \"%s\" %s) AND issuetype = Epic", project.Name, project.Jql)
+	return fmt.Sprintf("(%s) AND issuetype = Epic", strings.TrimSpace(fmt.Sprintf("project = \"%s\" %s", project.Name, project.Jql)))
 }
 
-func processEpic(jiraClient *jira.Client, epic jira.Issue, quarter, projectLabel, global string, batch *warp.Batch) {
-	issues, err := getIssues(jiraClient, epic.Key)
+// processEpic count the story points of the epic children and register the
+// epic series of each period
+func processEpic(issues []jira.Issue, epic jira.Issue, periods []string, project core.Project, dimensions map[string]string, batch *warp.Batch) epicPoints {
+	storyPoints, unestimated, dependency := computeStoryPoints(issues, project.Fields.StoryPoint)
+
+	// Gen metrics
+	now := time.Now().UTC()
+	for _, quarter := range periods {
+		gts := getEpicMetric("storypoint", epic, quarter, project.Label, dimensions).AddDatapoint(now, storyPoints["total"])
+		batch.Register(gts)
+		gts = getEpicMetric("unestimated", epic, quarter, project.Label, dimensions).AddDatapoint(now, float64(unestimated))
+		batch.Register(gts)
+		gts = getEpicMetric("dependency", epic, quarter, project.Label, dimensions).AddDatapoint(now, float64(dependency))
+		batch.Register(gts)
+		gts = getEpicMetric("storypoint.inprogress", epic, quarter, project.Label, dimensions).AddDatapoint(now, storyPoints["indeterminate"])
+		batch.Register(gts)
+		gts = getEpicMetric("storypoint.done", epic, quarter, project.Label, dimensions).AddDatapoint(now, storyPoints["done"])
+		batch.Register(gts)
+	}
+
+	return epicPoints{StoryPoints: storyPoints, Unestimated: unestimated}
+}
+
+// detectEpicChildren return the epic children strategy of the jira
+// deployment, the Epic Link field is deprecated on Jira Cloud
+func detectEpicChildren(jiraClient *jira.Client) (string, error) {
+	req, err := jiraClient.NewRequest("GET", "rest/api/2/serverInfo", nil)
 	if err != nil {
-		log.WithField("key", epic.Key).WithError(err).Warn("Fail to get jira issues")
-		return
+		return "", err
 	}
 
-	storyPoints, unestimated, dependency := computeStoryPoints(issues, storyPointField)
+	info := new(serverInfo)
+	if resp, err := jiraClient.Do(req, info); err != nil {
+		return "", jira.NewJiraError(resp, err)
+	}
 
-	// Gen metrics
-	now := time.Now().UTC()
-	gts := getEpicMetric("storypoint", epic, quarter, projectLabel, global).AddDatapoint(now, storyPoints["total"])
-	batch.Register(gts)
-	gts = getEpicMetric("unestimated", epic, quarter, projectLabel, global).AddDatapoint(now, float64(unestimated))
-	batch.Register(gts)
-	gts = getEpicMetric("dependency", epic, quarter, projectLabel, global).AddDatapoint(now, float64(dependency))
-	batch.Register(gts)
-	gts = getEpicMetric("storypoint.inprogress", epic, quarter, projectLabel, global).AddDatapoint(now, storyPoints["indeterminate"])
-	batch.Register(gts)
-	gts = getEpicMetric("storypoint.done", epic, quarter, projectLabel, global).AddDatapoint(now, storyPoints["done"])
-	batch.Register(gts)
-}
-
-func getIssues(jiraClient *jira.Client, epic string) ([]jira.Issue, error) {
+	if strings.EqualFold(info.DeploymentType, "Cloud") {
+		return core.EpicChildrenParent, nil
+	}
+	return core.EpicChildrenEpicLink, nil
+}
+
+// getEpicsChildren return the children of the epics per epic key. Children
+// are searched for several epics at once, in chunks of epicChildrenChunk
+// epics searched concurrently, except with a custom JQL which is searched
+// per epic. The epics of a failed search are missing from the result and an
+// error is returned
+func getEpicsChildren(jiraClient *jira.Client, project core.Project, epics []jira.Issue, concurrency int) (map[string][]jira.Issue, error) {
+	size := epicChildrenChunk
+	if project.EpicChildren == core.EpicChildrenJql {
+		size = 1
+	}
+
+	var chunks [][]string
+	for start := 0; start < len(epics); start += size {
+		end := start + size
+		if end > len(epics) {
+			end = len(epics)
+		}
+
+		keys := make([]string, 0, end-start)
+		for _, epic := range epics[start:end] {
+			keys = append(keys, epic.Key)
+		}
+		chunks = append(chunks, keys)
+	}
+
+	fields := []string{"id", "key", "labels", "summary", "status", project.Fields.StoryPoint}
+	switch project.EpicChildren {
+	case core.EpicChildrenParent:
+		fields = append(fields, core.ParentField)
+	case core.EpicChildrenEpicLink:
+		fields = append(fields, project.Fields.EpicLink)
+	}
+
+	results := make([][]jira.Issue, len(chunks))
+	errs := make([]error, len(chunks))
+	runWorkers(len(chunks), concurrency, func(i int) {
+		results[i], errs[i] = getIssues(jiraClient, getEpicChildrenQuery(project, chunks[i]), fields)
+	})
+
+	children := make(map[string][]jira.Issue, len(epics))
+	var failed error
+	for i, keys := range chunks {
+		if errs[i] != nil {
+			log.WithField("keys", strings.Join(keys, ",")).WithError(errs[i]).Warn("Fail to get jira issues")
+			failed = errs[i]
+			continue
+		}
+
+		for _, key := range keys {
+			children[key] = nil
+		}
+		if len(keys) == 1 {
+			children[keys[0]] = results[i]
+			continue
+		}
+		for _, issue := range results[i] {
+			epic := getIssueEpic(issue, project.EpicChildren, project.Fields.EpicLink)
+			if _, ok := children[epic]; ok {
+				children[epic] = append(children[epic], issue)
+			}
+		}
+	}
+
+	return children, failed
+}
+
+// getEpicChildrenQuery return the JQL searching the children of the epics
+// with the project strategy, a custom JQL only handles a single epic
+func getEpicChildrenQuery(project core.Project, epics []string) string {
+	switch project.EpicChildren {
+	case core.EpicChildrenParent:
+		return fmt.Sprintf("parent in (%s)", strings.Join(epics, ","))
+	case core.EpicChildrenJql:
+		return strings.Replace(project.EpicChildrenJql, core.EpicKeyPlaceholder, epics[0], -1)
+	}
+	return fmt.Sprintf("\"Epic Link\" in (%s)", strings.Join(epics, ","))
+}
+
+// getIssueEpic return the key of the epic of an issue, from its parent or
+// its Epic Link field
+func getIssueEpic(issue jira.Issue, strategy, epicLinkField string) string {
+	if strategy == core.EpicChildrenParent {
+		if issue.Fields.Parent == nil {
+			return ""
+		}
+		return issue.Fields.Parent.Key
+	}
+
+	v, ok := issue.Fields.Unknowns.Value(epicLinkField)
+	if !ok || v == nil {
+		return ""
+	}
+	key, _ := v.(string)
+	return key
+}
+
+func getIssues(jiraClient *jira.Client, jql string, fields []string) ([]jira.Issue, error) {
 	var issues []jira.Issue
-	err := jiraClient.Issue.SearchPages(fmt.Sprintf("\"Epic Link\" = %s", epic), &jira.SearchOptions{
-		Fields: []string{"id", "key", "labels", "summary", "status", storyPointField},
+	err := jiraClient.Issue.SearchPages(jql, &jira.SearchOptions{
+		Fields: fields,
 	}, func(issue jira.Issue) error {
 		issues = append(issues, issue)
 		return nil
@@ -150,12 +365,23 @@ func getStatus(issue jira.Issue) string {
 	return issue.Fields.Status.StatusCategory.Key
 }
 
-func getEpicMetric(name string, epic jira.Issue, quarter, projectLabel, global string) *warp.GTS {
-	return warp.NewGTS(fmt.Sprintf("jerem.jira.epic.%s", name)).WithLabels(warp.Labels{
+func getEpicDimensions(epic jira.Issue, dimensions []core.Dimension) map[string]string {
+	res := make(map[string]string, len(dimensions))
+	for _, dimension := range dimensions {
+		res[dimension.Label] = dimension.Value(epic.Fields.Labels)
+	}
+	return res
+}
+
+func getEpicMetric(name string, epic jira.Issue, quarter, projectLabel string, dimensions map[string]string) *warp.GTS {
+	labels := warp.Labels{
 		"project": projectLabel,
 		"key":     epic.Key,
 		"summary": epic.Fields.Summary,
 		"quarter": quarter,
-		"global":  global,
-	})
+	}
+	for label, value := range dimensions {
+		labels[label] = value
+	}
+	return warp.NewGTS(fmt.Sprintf("jerem.jira.epic.%s", name)).WithLabels(labels)
 }
@@ -1,47 +1,166 @@
 package runner
 
 import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
 	"testing"
+	"time"
 
+	jira "github.com/andygrunwald/go-jira"
 	"github.com/ovh/jerem/src/core"
 	"github.com/stretchr/testify/require"
 )
 
-func TestGetEpicQuerysWithNoProjects(t *testing.T) {
+func TestGetEpicQueryWithoutJql(t *testing.T) {
 	assert := require.New(t)
 
-	projects := []core.Project{}
+	project := core.Project{
+		Name: "PJ1",
+	}
 
-	query := getEpicQuery(projects)
+	query := getEpicQuery(project)
 
-	assert.Equal(query, "")
+	assert.Equal(query, "(project = \"PJ1\") AND issuetype = Epic")
 }
-func TestGetEpicQuerysWithOneProjects(t *testing.T) {
+func TestGetEpicQueryWithJql(t *testing.T) {
 	assert := require.New(t)
 
-	projects := []core.Project{
-		core.Project{
-			Name: "PJ1",
-		},
+	project := core.Project{
+		Name: "PJ1",
+		Jql:  "AND (component = test)",
 	}
 
-	query := getEpicQuery(projects)
+	query := getEpicQuery(project)
 
-	assert.Equal(query, "(project = \"PJ1\") AND issuetype = Epic")
+	assert.Equal(query, "(project = \"PJ1\" AND (component = test)) AND issuetype = Epic")
 }
-func TestGetEpicQuerysWithMultipleProjects(t *testing.T) {
+func TestGetEpicPeriods(t *testing.T) {
 	assert := require.New(t)
 
-	projects := []core.Project{
-		core.Project{
-			Name: "PJ1",
-		},
-		core.Project{
-			Name: "PJ2",
-		},
+	periods := core.Periods{
+		Patterns: []*regexp.Regexp{regexp.MustCompile(core.DefaultPeriodPattern), regexp.MustCompile(`^PI-(\d{4}\.\d)$`)},
+		Fallback: core.PeriodFallbackNone,
+		Unit:     core.PeriodQuarter,
 	}
 
-	query := getEpicQuery(projects)
+	epic := jira.Issue{Fields: &jira.IssueFields{
+		Labels:      []string{"Project_Jerem", "Q3-24", "PI-2024.3"},
+		Duedate:     jira.Date(time.Date(2024, 11, 1, 0, 0, 0, 0, time.UTC)),
+		FixVersions: []*jira.FixVersion{{Name: "PI-2024.4"}, {Name: "v1.2"}},
+	}}
+	assert.Equal([]string{"Q3-24", "2024.3"}, getEpicPeriods(epic, periods))
+
+	epic.Fields.Labels = []string{"Project_Jerem"}
+	assert.Empty(getEpicPeriods(epic, periods))
+
+	periods.Fallback = core.PeriodFallbackDueDate
+	assert.Equal([]string{"Q4-24"}, getEpicPeriods(epic, periods))
+
+	periods.Fallback = core.PeriodFallbackFixVersion
+	assert.Equal([]string{"2024.4"}, getEpicPeriods(epic, periods))
+
+	// Fix versions matching no pattern give no quarter
+	epic.Fields.FixVersions = []*jira.FixVersion{{Name: "v1.2"}}
+	assert.Empty(getEpicPeriods(epic, periods))
+}
+
+func TestGetEpicMetricDimensions(t *testing.T) {
+	assert := require.New(t)
+
+	epic := jira.Issue{Key: "PJ1-1", Fields: &jira.IssueFields{
+		Summary: "Epic",
+		Labels:  []string{"Q3-24", "Project_Jerem", "Team_Observability"},
+	}}
+	dimensions := getEpicDimensions(epic, []core.Dimension{
+		{Label: "global", Prefix: "Project_", Default: "None"},
+		{Label: "team", Prefix: "Team_", Default: "None"},
+		{Label: "theme", Prefix: "Theme_", Default: "None"},
+	})
+
+	gts := getEpicMetric("storypoint", epic, "Q3-24", "PJ1", dimensions)
+	assert.Equal(map[string]string{
+		"project": "PJ1",
+		"key":     "PJ1-1",
+		"summary": "Epic",
+		"quarter": "Q3-24",
+		"global":  "Jerem",
+		"team":    "Observability",
+		"theme":   "None",
+	}, gts.Labels)
+}
+func TestGetEpicChildrenQuery(t *testing.T) {
+	assert := require.New(t)
+
+	assert.Equal("\"Epic Link\" in (PJ1-1,PJ1-2)", getEpicChildrenQuery(core.Project{EpicChildren: core.EpicChildrenEpicLink}, []string{"PJ1-1", "PJ1-2"}))
+	assert.Equal("parent in (PJ1-1,PJ1-2)", getEpicChildrenQuery(core.Project{EpicChildren: core.EpicChildrenParent}, []string{"PJ1-1", "PJ1-2"}))
+	assert.Equal("parent = PJ1-1 OR \"Epic Link\" = PJ1-1", getEpicChildrenQuery(core.Project{
+		EpicChildren:    core.EpicChildrenJql,
+		EpicChildrenJql: "parent = {key} OR \"Epic Link\" = {key}",
+	}, []string{"PJ1-1"}))
+}
+func TestGetEpicsChildren(t *testing.T) {
+	assert := require.New(t)
+
+	var queries []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/rest/api/2/search", func(w http.ResponseWriter, r *http.Request) {
+		jql := r.URL.Query().Get("jql")
+		queries = append(queries, jql)
+		if jql != "\"Epic Link\" in (PJ1-1,PJ1-2,PJ1-3)" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(`{"startAt": 0, "maxResults": 50, "total": 3, "issues": [
+			{"key": "PJ1-4", "fields": {"customfield_10008": "PJ1-1"}},
+			{"key": "PJ1-5", "fields": {"customfield_10008": "PJ1-3"}},
+			{"key": "PJ1-6", "fields": {"customfield_10008": "PJ1-1"}}
+		]}`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	jiraClient, err := NewJiraClient(core.Jira{Auth: core.Auth{Type: core.AuthBasic}, URL: server.URL})
+	assert.NoError(err)
+
+	project := core.Project{EpicChildren: core.EpicChildrenEpicLink, Fields: core.Fields{StoryPoint: "customfield_10006", EpicLink: "customfield_10008"}}
+	epics := []jira.Issue{{Key: "PJ1-1"}, {Key: "PJ1-2"}, {Key: "PJ1-3"}}
+
+	children, err := getEpicsChildren(jiraClient, project, epics, 2)
+	assert.NoError(err)
+	assert.Len(queries, 1)
+	assert.Len(children, 3)
+	assert.Len(children["PJ1-1"], 2)
+	assert.Len(children["PJ1-2"], 0)
+	assert.Equal("PJ1-5", children["PJ1-3"][0].Key)
+
+	// The children of a failed search are missing
+	project.EpicChildren = core.EpicChildrenParent
+	children, err = getEpicsChildren(jiraClient, project, epics, 2)
+	assert.Error(err)
+	assert.Len(children, 0)
+}
+func TestDetectEpicChildren(t *testing.T) {
+	assert := require.New(t)
+
+	deployment := "Cloud"
+	mux := http.NewServeMux()
+	mux.HandleFunc("/rest/api/2/serverInfo", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(fmt.Sprintf(`{"deploymentType": "%s"}`, deployment)))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	jiraClient, err := NewJiraClient(core.Jira{Auth: core.Auth{Type: core.AuthBasic}, URL: server.URL})
+	assert.NoError(err)
+
+	strategy, err := detectEpicChildren(jiraClient)
+	assert.NoError(err)
+	assert.Equal(core.EpicChildrenParent, strategy)
 
-	assert.Equal(query, "(project = \"PJ1\" OR project = \"PJ2\") AND issuetype = Epic")
+	deployment = "Server"
+	strategy, err = detectEpicChildren(jiraClient)
+	assert.NoError(err)
+	assert.Equal(core.EpicChildrenEpicLink, strategy)
 }
@@ -0,0 +1,148 @@
+package runner
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	jira "github.com/andygrunwald/go-jira"
+
+	"github.com/ovh/jerem/src/core"
+)
+
+var fieldIDRegex = regexp.MustCompile(`^customfield_\d+$`)
+
+// ResolveFields replace the custom fields configured by display name with
+// their id, using the jira field list, and resolve the epic children strategy
+// of the auto projects with the Epic Link field they may need. Jira is only
+// requested when something is left to resolve
+func ResolveFields(config core.Config) (core.Config, error) {
+	byName := !isFieldID(config.Jira.Fields)
+	auto := false
+	for _, project := range config.Projects {
+		byName = byName || !isFieldID(project.Fields)
+		auto = auto || project.EpicChildren == core.EpicChildrenAuto || project.EpicChildren == ""
+	}
+	if !byName && !auto && !needEpicLink(config.Projects) {
+		return config, nil
+	}
+
+	jiraClient, err := NewJiraClient(config.Jira)
+	if err != nil {
+		return config, err
+	}
+
+	// The epic children strategy of the auto projects depends on the jira
+	// deployment
+	projects := make([]core.Project, 0, len(config.Projects))
+	strategy := ""
+	for _, project := range config.Projects {
+		if project.EpicChildren == core.EpicChildrenAuto || project.EpicChildren == "" {
+			if strategy == "" {
+				strategy, err = detectEpicChildren(jiraClient)
+				if err != nil {
+					return config, fmt.Errorf("fail to detect the epic children strategy: %s", err)
+				}
+			}
+			project.EpicChildren = strategy
+		}
+		projects = append(projects, project)
+	}
+
+	epicLink := needEpicLink(projects)
+	if !byName && !epicLink {
+		config.Projects = projects
+		return config, nil
+	}
+
+	fields, _, err := jiraClient.Field.GetList()
+	if err != nil {
+		return config, fmt.Errorf("fail to list jira fields: %s", err)
+	}
+
+	if byName {
+		config.Jira.Fields, err = resolveFields(fields, config.Jira.Fields)
+		if err != nil {
+			return config, err
+		}
+	}
+
+	epicLinkField := ""
+	if epicLink {
+		epicLinkField, err = resolveField(fields, epicLinkName)
+		if err != nil {
+			return config, fmt.Errorf("fail to get the epic link field: %s", err)
+		}
+	}
+
+	for i, project := range projects {
+		if byName {
+			project.Fields, err = resolveFields(fields, project.Fields)
+			if err != nil {
+				return config, fmt.Errorf("project %s: %s", project.Name, err)
+			}
+		}
+		if project.EpicChildren == core.EpicChildrenEpicLink && project.Fields.EpicLink == "" {
+			project.Fields.EpicLink = epicLinkField
+		}
+		projects[i] = project
+	}
+	config.Projects = projects
+
+	return config, nil
+}
+
+// needEpicLink return true when a project search the epic children with
+// the Epic Link field not resolved yet
+func needEpicLink(projects []core.Project) bool {
+	for _, project := range projects {
+		if project.EpicChildren == core.EpicChildrenEpicLink && project.Fields.EpicLink == "" {
+			return true
+		}
+	}
+	return false
+}
+
+func isFieldID(fields core.Fields) bool {
+	parentLink := fields.ParentLink == "" || fields.ParentLink == core.ParentField || fieldIDRegex.MatchString(fields.ParentLink)
+	return fieldIDRegex.MatchString(fields.StoryPoint) && fieldIDRegex.MatchString(fields.Impediment) && parentLink
+}
+
+func resolveFields(fields []jira.Field, configured core.Fields) (core.Fields, error) {
+	storyPoint, err := resolveField(fields, configured.StoryPoint)
+	if err != nil {
+		return configured, err
+	}
+
+	impediment, err := resolveField(fields, configured.Impediment)
+	if err != nil {
+		return configured, err
+	}
+
+	parentLink := configured.ParentLink
+	if parentLink != "" && parentLink != core.ParentField {
+		parentLink, err = resolveField(fields, parentLink)
+		if err != nil {
+			return configured, err
+		}
+	}
+
+	return core.Fields{StoryPoint: storyPoint, Impediment: impediment, ParentLink: parentLink}, nil
+}
+
+// resolveField return the id of a field given by id or by display name
+func resolveField(fields []jira.Field, field string) (string, error) {
+	for _, f := range fields {
+		if f.ID == field {
+			return f.ID, nil
+		}
+	}
+
+	for _, f := range fields {
+		if strings.EqualFold(f.Name, field) {
+			return f.ID, nil
+		}
+	}
+
+	return "", fmt.Errorf("unknown field '%s'", field)
+}
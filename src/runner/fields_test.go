@@ -0,0 +1,92 @@
+package runner
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ovh/jerem/src/core"
+)
+
+func TestResolveFields(t *testing.T) {
+	assert := require.New(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal("/rest/api/2/field", r.URL.Path)
+		w.Write([]byte(`[{"id": "customfield_10006", "name": "Story Points"}, {"id": "customfield_10016", "name": "Story point estimate"}, {"id": "customfield_11028", "name": "Impediment"}]`))
+	}))
+	defer server.Close()
+
+	config, err := ResolveFields(core.Config{
+		Jira: core.Jira{Auth: core.Auth{Type: core.AuthBasic}, URL: server.URL, Fields: core.Fields{StoryPoint: "Story Points", Impediment: "customfield_11028"}},
+		Projects: []core.Project{
+			{Name: "K8S", Fields: core.Fields{StoryPoint: "story point estimate", Impediment: "Impediment"}, EpicChildren: core.EpicChildrenParent},
+		},
+	})
+	assert.NoError(err)
+	assert.Equal(core.Fields{StoryPoint: "customfield_10006", Impediment: "customfield_11028"}, config.Jira.Fields)
+	assert.Equal(core.Fields{StoryPoint: "customfield_10016", Impediment: "customfield_11028"}, config.Projects[0].Fields)
+
+	_, err = ResolveFields(core.Config{
+		Jira: core.Jira{Auth: core.Auth{Type: core.AuthBasic}, URL: server.URL, Fields: core.Fields{StoryPoint: "Unknown", Impediment: "customfield_11028"}},
+	})
+	assert.EqualError(err, "unknown field 'Unknown'")
+}
+
+func TestResolveFieldsByID(t *testing.T) {
+	assert := require.New(t)
+
+	// Jira isn't requested when all fields are ids
+	fields := core.Fields{StoryPoint: "customfield_1", Impediment: "customfield_2"}
+	config, err := ResolveFields(core.Config{
+		Jira:     core.Jira{Auth: core.Auth{Type: core.AuthBasic}, URL: "http://127.0.0.1:1", Fields: fields},
+		Projects: []core.Project{{Name: "K8S", Fields: fields, EpicChildren: core.EpicChildrenParent}},
+	})
+	assert.NoError(err)
+	assert.Equal(fields, config.Projects[0].Fields)
+}
+
+func TestResolveEpicChildren(t *testing.T) {
+	assert := require.New(t)
+
+	var requests int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/rest/api/2/serverInfo", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Write([]byte(`{"deploymentType": "Server"}`))
+	})
+	mux.HandleFunc("/rest/api/2/field", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Write([]byte(`[{"id": "customfield_10008", "name": "Epic Link"}]`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	// The auto projects use the strategy of the jira deployment, the Epic
+	// Link field is only set on the epiclink projects
+	fields := core.Fields{StoryPoint: "customfield_1", Impediment: "customfield_2"}
+	config, err := ResolveFields(core.Config{
+		Jira: core.Jira{Auth: core.Auth{Type: core.AuthBasic}, URL: server.URL, Fields: fields},
+		Projects: []core.Project{
+			{Name: "K8S", Fields: fields, EpicChildren: core.EpicChildrenAuto},
+			{Name: "OB", Fields: fields},
+			{Name: "NET", Fields: fields, EpicChildren: core.EpicChildrenParent},
+		},
+	})
+	assert.NoError(err)
+	assert.Equal(int32(2), atomic.LoadInt32(&requests))
+	assert.Equal(core.EpicChildrenEpicLink, config.Projects[0].EpicChildren)
+	assert.Equal("customfield_10008", config.Projects[0].Fields.EpicLink)
+	assert.Equal(core.EpicChildrenEpicLink, config.Projects[1].EpicChildren)
+	assert.Equal("customfield_10008", config.Projects[1].Fields.EpicLink)
+	assert.Equal(core.EpicChildrenParent, config.Projects[2].EpicChildren)
+	assert.Equal("", config.Projects[2].Fields.EpicLink)
+
+	// Resolving again doesn't request jira
+	_, err = ResolveFields(config)
+	assert.NoError(err)
+	assert.Equal(int32(2), atomic.LoadInt32(&requests))
+}
@@ -0,0 +1,323 @@
+package runner
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	warp "github.com/PierreZ/Warp10Exporter"
+	jira "github.com/andygrunwald/go-jira"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/ovh/jerem/src/core"
+)
+
+var flowPercentiles = []struct {
+	name  string
+	value float64
+}{
+	{"p50", 0.50},
+	{"p85", 0.85},
+	{"p95", 0.95},
+}
+
+// issueFlow is the time spent by a resolved issue in the workflow
+type issueFlow struct {
+	Done         time.Time
+	LeadTime     time.Duration
+	CycleTime    time.Duration
+	Started      bool
+	TimeInStatus map[string]time.Duration
+}
+
+// FlowRunner runner handling flow metrics, it reads the changelog of the
+// resolved issues to compute their lead time, cycle time and time spent in
+// each status
+func FlowRunner(config core.Config, sink core.Sink) error {
+	if !config.Flow.Enabled {
+		return nil
+	}
+
+	jiraClient, err := NewJiraClient(config.Jira)
+	if err != nil {
+		log.WithError(err).Error("Fail to get jira client")
+		return err
+	}
+
+	statuses, _, err := jiraClient.Status.GetAllStatuses()
+	if err != nil {
+		log.WithError(err).Error("Fail to get statuses")
+		return err
+	}
+	categories := getStatusCategories(statuses)
+
+	now := time.Now().UTC()
+
+	batch, failed := collectProjects(config.Projects, config.Concurrency, func(project core.Project, batch *warp.Batch) error {
+		return processFlow(jiraClient, project, config.Flow.Window, categories, batch, now)
+	})
+
+	return runnerError(failed, pushBatch(sink, "flow", batch))
+}
+
+// processFlow register the flow metrics of the issues resolved during the
+// window and, for scrum boards, in the active sprints of a project
+func processFlow(jiraClient *jira.Client, project core.Project, window time.Duration, categories map[string]string, batch *warp.Batch, now time.Time) error {
+	windowLabel := getWindowLabel(window)
+
+	// Issues resolved during the rolling window
+	issues, err := getFlowIssues(jiraClient, fmt.Sprintf("(project = \"%s\" %s) AND statusCategory = Done AND resolved >= -%dm", project.Name, project.Jql, int(window.Minutes())))
+	if err != nil {
+		log.WithField("project", project.Name).WithError(err).Warn("Fail to get resolved issues")
+		return err
+	}
+
+	// Set each issue lead and cycle time at its resolution date
+	flows := computeFlows(issues, categories)
+	leadTime := getFlowMetric("leadtime", project.Label, "window", windowLabel)
+	cycleTime := getFlowMetric("cycletime", project.Label, "window", windowLabel)
+	for _, flow := range flows {
+		leadTime.AddDatapoint(flow.Done, flow.LeadTime.Seconds())
+		if flow.Started {
+			cycleTime.AddDatapoint(flow.Done, flow.CycleTime.Seconds())
+		}
+	}
+	if len(leadTime.Datapoints) > 0 {
+		batch.Register(leadTime)
+	}
+	if len(cycleTime.Datapoints) > 0 {
+		batch.Register(cycleTime)
+	}
+	registerFlowPercentiles(batch, flows, now, project.Label, "window", windowLabel)
+
+	// Kanban boards have no sprint
+	mode, err := getProjectMode(jiraClient, project)
+	if err != nil {
+		log.WithField("project", project.Name).WithError(err).Warn("Fail to get board type")
+		return err
+	}
+	if mode == core.ModeKanban {
+		return nil
+	}
+
+	// Issues resolved in the active sprints
+	options := &jira.GetAllSprintsOptions{State: "active"}
+	sprints, _, err := jiraClient.Board.GetAllSprintsWithOptions(project.Board, options)
+	if err != nil {
+		log.WithField("project", project.Name).WithError(err).Warn("Fail to get sprints")
+		return err
+	}
+
+	for _, sprint := range sprints.Values {
+		issues, err := getFlowIssues(jiraClient, fmt.Sprintf("(project = \"%s\" %s) AND statusCategory = Done AND sprint = %d", project.Name, project.Jql, sprint.ID))
+		if err != nil {
+			log.WithFields(log.Fields{"sprint": sprint.Name, "project": project.Label}).
+				WithError(err).Warn("Fail to get sprint resolved issues")
+			return err
+		}
+
+		flows := computeFlows(issues, categories)
+		registerFlowPercentiles(batch, flows, now, project.Label, "sprint", "current")
+		registerFlowPercentiles(batch, flows, now, project.Label, "sprint", sprint.Name)
+	}
+
+	return nil
+}
+
+func getFlowIssues(jiraClient *jira.Client, jql string) ([]jira.Issue, error) {
+	var issues []jira.Issue
+	err := jiraClient.Issue.SearchPages(jql, &jira.SearchOptions{
+		Fields: []string{"id", "key", "created", "status", "resolutiondate"},
+		Expand: "changelog",
+	}, func(issue jira.Issue) error {
+		issues = append(issues, issue)
+		return nil
+	})
+	return issues, err
+}
+
+// getStatusCategories map the lower cased status names to their category
+// key [undefined, new, indeterminate, done]
+func getStatusCategories(statuses []jira.Status) map[string]string {
+	categories := make(map[string]string, len(statuses))
+	for _, status := range statuses {
+		categories[strings.ToLower(status.Name)] = status.StatusCategory.Key
+	}
+	return categories
+}
+
+func getWindowLabel(window time.Duration) string {
+	if window%(24*time.Hour) == 0 {
+		return fmt.Sprintf("%dd", window/(24*time.Hour))
+	}
+	return window.String()
+}
+
+func computeFlows(issues []jira.Issue, categories map[string]string) []issueFlow {
+	var flows []issueFlow
+	for _, issue := range issues {
+		flow, ok := computeFlow(issue, categories)
+		if !ok {
+			log.WithField("key", issue.Key).Debug("Issue is not resolved")
+			continue
+		}
+		flows = append(flows, flow)
+	}
+	return flows
+}
+
+type statusTransition struct {
+	at   time.Time
+	from string
+	to   string
+}
+
+// getStatusTransitions return the issue status transitions of its
+// changelog, sorted by date
+func getStatusTransitions(issue jira.Issue) []statusTransition {
+	var transitions []statusTransition
+	if issue.Changelog == nil {
+		return transitions
+	}
+
+	for _, history := range issue.Changelog.Histories {
+		at, err := history.CreatedTime()
+		if err != nil {
+			log.WithField("key", issue.Key).WithError(err).Warn("Fail to parse changelog date")
+			continue
+		}
+		for _, item := range history.Items {
+			if item.Field == "status" {
+				transitions = append(transitions, statusTransition{at: at, from: item.FromString, to: item.ToString})
+			}
+		}
+	}
+	sort.SliceStable(transitions, func(i, j int) bool {
+		return transitions[i].at.Before(transitions[j].at)
+	})
+	return transitions
+}
+
+// getStatusAt return the issue status name at the given date, the issue is
+// considered in its initial status before its creation
+func getStatusAt(issue jira.Issue, transitions []statusTransition, at time.Time) string {
+	status := ""
+	if len(transitions) > 0 {
+		status = transitions[0].from
+	} else if issue.Fields.Status != nil {
+		status = issue.Fields.Status.Name
+	}
+
+	for _, transition := range transitions {
+		if transition.at.After(at) {
+			break
+		}
+		status = transition.to
+	}
+	return status
+}
+
+// computeFlow walk the issue status transitions. The cycle starts on the
+// first transition to an indeterminate status and the issue is done on its
+// last transition to a done status. Time spent in done statuses is ignored
+func computeFlow(issue jira.Issue, categories map[string]string) (issueFlow, bool) {
+	transitions := getStatusTransitions(issue)
+	created := time.Time(issue.Fields.Created)
+	status := getStatusAt(issue, transitions, created)
+
+	flow := issueFlow{TimeInStatus: make(map[string]time.Duration)}
+	var start time.Time
+	if categories[strings.ToLower(status)] == "indeterminate" {
+		start = created
+	}
+
+	since := created
+	for _, transition := range transitions {
+		if categories[strings.ToLower(status)] != "done" {
+			flow.TimeInStatus[status] += transition.at.Sub(since)
+		}
+		status = transition.to
+		since = transition.at
+
+		switch categories[strings.ToLower(status)] {
+		case "indeterminate":
+			if start.IsZero() {
+				start = transition.at
+			}
+		case "done":
+			flow.Done = transition.at
+		}
+	}
+
+	if flow.Done.IsZero() {
+		flow.Done = time.Time(issue.Fields.Resolutiondate)
+	}
+	if flow.Done.IsZero() {
+		return flow, false
+	}
+
+	flow.LeadTime = flow.Done.Sub(created)
+	if !start.IsZero() && !start.After(flow.Done) {
+		flow.Started = true
+		flow.CycleTime = flow.Done.Sub(start)
+	}
+
+	return flow, true
+}
+
+// registerFlowPercentiles register the flow percentiles of the issues, the
+// series are identified by the project and the given scope label
+func registerFlowPercentiles(batch *warp.Batch, flows []issueFlow, now time.Time, projectLabel, scope, value string) {
+	var leadTimes, cycleTimes []float64
+	timeInStatus := make(map[string][]float64)
+	for _, flow := range flows {
+		leadTimes = append(leadTimes, flow.LeadTime.Seconds())
+		if flow.Started {
+			cycleTimes = append(cycleTimes, flow.CycleTime.Seconds())
+		}
+		for status, d := range flow.TimeInStatus {
+			timeInStatus[status] = append(timeInStatus[status], d.Seconds())
+		}
+	}
+
+	batch.Register(getFlowMetric("count", projectLabel, scope, value).AddDatapoint(now, len(flows)))
+
+	for _, p := range flowPercentiles {
+		if len(leadTimes) > 0 {
+			batch.Register(getFlowMetric(fmt.Sprintf("leadtime.%s", p.name), projectLabel, scope, value).AddDatapoint(now, percentile(leadTimes, p.value)))
+		}
+		if len(cycleTimes) > 0 {
+			batch.Register(getFlowMetric(fmt.Sprintf("cycletime.%s", p.name), projectLabel, scope, value).AddDatapoint(now, percentile(cycleTimes, p.value)))
+		}
+		for status, values := range timeInStatus {
+			gts := getFlowMetric(fmt.Sprintf("status.%s", p.name), projectLabel, scope, value)
+			gts.Labels["status"] = status
+			batch.Register(gts.AddDatapoint(now, percentile(values, p.value)))
+		}
+	}
+}
+
+// percentile return the nearest rank percentile of the values
+func percentile(values []float64, p float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+
+	rank := int(math.Ceil(p*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	return sorted[rank]
+}
+
+func getFlowMetric(name, projectLabel, scope, value string) *warp.GTS {
+	return warp.NewGTS(fmt.Sprintf("jerem.jira.flow.%s", name)).WithLabels(warp.Labels{
+		"project": projectLabel,
+		scope:     value,
+	})
+}
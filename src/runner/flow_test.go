@@ -0,0 +1,126 @@
+package runner
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	warp "github.com/PierreZ/Warp10Exporter"
+	jira "github.com/andygrunwald/go-jira"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ovh/jerem/src/core"
+)
+
+var flowCategories = map[string]string{
+	"to do":       "new",
+	"in progress": "indeterminate",
+	"review":      "indeterminate",
+	"done":        "done",
+}
+
+func statusChange(created, from, to string) jira.ChangelogHistory {
+	return jira.ChangelogHistory{
+		Created: created,
+		Items:   []jira.ChangelogItems{{Field: "status", FromString: from, ToString: to}},
+	}
+}
+
+func TestComputeFlow(t *testing.T) {
+	assert := require.New(t)
+
+	created := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	issue := jira.Issue{
+		Key: "PJ1-1",
+		Fields: &jira.IssueFields{
+			Created: jira.Time(created),
+			Status:  &jira.Status{Name: "Done"},
+		},
+		Changelog: &jira.Changelog{Histories: []jira.ChangelogHistory{
+			statusChange("2020-01-02T00:00:00.000+0000", "To Do", "In Progress"),
+			statusChange("2020-01-04T00:00:00.000+0000", "In Progress", "Review"),
+			statusChange("2020-01-05T00:00:00.000+0000", "Review", "Done"),
+			// Reopened then closed again
+			statusChange("2020-01-06T00:00:00.000+0000", "Done", "In Progress"),
+			statusChange("2020-01-06T12:00:00.000+0000", "In Progress", "Done"),
+		}},
+	}
+
+	flow, ok := computeFlow(issue, flowCategories)
+	assert.True(ok)
+	assert.True(flow.Started)
+	assert.Equal(time.Date(2020, 1, 6, 12, 0, 0, 0, time.UTC), flow.Done.UTC())
+	assert.Equal(132*time.Hour, flow.LeadTime)
+	assert.Equal(108*time.Hour, flow.CycleTime)
+	assert.Equal(map[string]time.Duration{
+		"To Do":       24 * time.Hour,
+		"In Progress": 60 * time.Hour,
+		"Review":      24 * time.Hour,
+	}, flow.TimeInStatus)
+}
+
+func TestComputeFlowWithoutChangelog(t *testing.T) {
+	assert := require.New(t)
+
+	created := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	issue := jira.Issue{
+		Key: "PJ1-1",
+		Fields: &jira.IssueFields{
+			Created:        jira.Time(created),
+			Resolutiondate: jira.Time(created.Add(48 * time.Hour)),
+			Status:         &jira.Status{Name: "Done"},
+		},
+	}
+
+	flow, ok := computeFlow(issue, flowCategories)
+	assert.True(ok)
+	assert.False(flow.Started)
+	assert.Equal(48*time.Hour, flow.LeadTime)
+
+	issue.Fields.Resolutiondate = jira.Time{}
+	_, ok = computeFlow(issue, flowCategories)
+	assert.False(ok)
+}
+
+func TestPercentile(t *testing.T) {
+	assert := require.New(t)
+
+	values := []float64{5, 1, 4, 2, 3, 6, 7, 8, 9, 10}
+	assert.Equal(5.0, percentile(values, 0.50))
+	assert.Equal(9.0, percentile(values, 0.85))
+	assert.Equal(10.0, percentile(values, 0.95))
+	assert.Equal(0.0, percentile(nil, 0.50))
+}
+
+func TestGetWindowLabel(t *testing.T) {
+	assert := require.New(t)
+
+	assert.Equal("30d", getWindowLabel(30*24*time.Hour))
+	assert.Equal("12h0m0s", getWindowLabel(12*time.Hour))
+}
+
+func TestProcessFlowKanban(t *testing.T) {
+	assert := require.New(t)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/rest/agile/1.0/board/3", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"id": 3, "type": "kanban"}`))
+	})
+	mux.HandleFunc("/rest/agile/1.0/board/3/sprint", func(w http.ResponseWriter, r *http.Request) {
+		// Kanban boards reject the sprints requests
+		w.WriteHeader(http.StatusBadRequest)
+	})
+	mux.HandleFunc("/rest/api/2/search", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"startAt": 0, "maxResults": 50, "total": 0, "issues": []}`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	jiraClient, err := NewJiraClient(core.Jira{Auth: core.Auth{Type: core.AuthBasic}, URL: server.URL})
+	assert.NoError(err)
+
+	project := core.Project{Name: "OPS", Label: "OPS", Board: 3}
+	batch := warp.NewBatch()
+	assert.NoError(processFlow(jiraClient, project, 14*24*time.Hour, flowCategories, batch, time.Now().UTC()))
+}
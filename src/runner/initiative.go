@@ -0,0 +1,189 @@
+package runner
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	warp "github.com/PierreZ/Warp10Exporter"
+	jira "github.com/andygrunwald/go-jira"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/ovh/jerem/src/core"
+)
+
+// parentChunk is the number of epic parents, like initiatives, searched in
+// a single JQL query
+const parentChunk = 50
+
+// epicPoints is the story points of an epic children
+type epicPoints struct {
+	StoryPoints map[string]float64
+	Unestimated int
+}
+
+// getParentLink return the key of the epic parent, like its initiative, read
+// from the parent link field. Advanced Roadmaps return the parent in a data
+// object, while Jira Cloud use the parent system field
+func getParentLink(epic jira.Issue, field string) string {
+	if field == "" {
+		return ""
+	}
+
+	if field == core.ParentField {
+		if epic.Fields.Parent == nil {
+			return ""
+		}
+		return epic.Fields.Parent.Key
+	}
+
+	v, ok := epic.Fields.Unknowns.Value(field)
+	if !ok || v == nil {
+		return ""
+	}
+	switch value := v.(type) {
+	case string:
+		return value
+	case map[string]interface{}:
+		if key, ok := value["key"].(string); ok {
+			return key
+		}
+		if data, ok := value["data"].(map[string]interface{}); ok {
+			if key, ok := data["key"].(string); ok {
+				return key
+			}
+		}
+	}
+	return ""
+}
+
+// processInitiatives register the initiative series, aggregated from the
+// story points of their child epics, and the theme series, the parents of
+// the initiatives read from the parent link fields. Levels above the themes
+// are not collected
+func processInitiatives(jiraClient *jira.Client, initiatives map[string]map[string]epicPoints, parentFields []string, concurrency int, batch *warp.Batch) error {
+	parents, failed := processParents(jiraClient, "initiative", initiatives, parentFields, concurrency, batch)
+	if failed != nil {
+		// Themes would miss the epics of the initiatives not found
+		log.WithError(failed).Warn("Some initiatives couldn't be collected, skipping the themes")
+		return failed
+	}
+
+	// A theme sum the epics of its initiatives
+	themes := make(map[string]map[string]epicPoints)
+	for key, parent := range parents {
+		if themes[parent] == nil {
+			themes[parent] = make(map[string]epicPoints)
+		}
+		for epic, points := range initiatives[key] {
+			themes[parent][epic] = points
+		}
+	}
+
+	if len(themes) > 0 {
+		if _, err := processParents(jiraClient, "theme", themes, nil, concurrency, batch); err != nil {
+			failed = err
+		}
+	}
+	return failed
+}
+
+// processParents register the series of a level of epic parents, like the
+// initiatives, and return the parent key of each of them. Unknown keys are
+// skipped
+func processParents(jiraClient *jira.Client, level string, epics map[string]map[string]epicPoints, parentFields []string, concurrency int, batch *warp.Batch) (map[string]string, error) {
+	keys := make([]string, 0, len(epics))
+	for key := range epics {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	issues, err := getIssuesByKey(jiraClient, keys, append([]string{"id", "key", "summary"}, parentFields...), concurrency)
+
+	now := time.Now().UTC()
+	parents := make(map[string]string)
+	for _, key := range keys {
+		issue, ok := issues[key]
+		if !ok {
+			log.WithFields(log.Fields{"key": key, "hierarchy": level}).Warn("Epic parent not found")
+			continue
+		}
+
+		summary := issue.Fields.Summary
+		storyPoints, unestimated := sumEpicPoints(epics[key])
+		batch.Register(getParentMetric(level, "storypoint", key, summary).AddDatapoint(now, storyPoints["total"]))
+		batch.Register(getParentMetric(level, "unestimated", key, summary).AddDatapoint(now, float64(unestimated)))
+		batch.Register(getParentMetric(level, "storypoint.inprogress", key, summary).AddDatapoint(now, storyPoints["indeterminate"]))
+		batch.Register(getParentMetric(level, "storypoint.done", key, summary).AddDatapoint(now, storyPoints["done"]))
+
+		for _, field := range parentFields {
+			if parent := getParentLink(issue, field); parent != "" {
+				parents[key] = parent
+				break
+			}
+		}
+	}
+
+	return parents, err
+}
+
+// getIssuesByKey return the issues per key, searched in chunks of
+// parentChunk keys. Jira only warns about the unknown or hidden keys, which
+// are missing from the result. The issues of a failed search are missing and
+// an error is returned
+func getIssuesByKey(jiraClient *jira.Client, keys []string, fields []string, concurrency int) (map[string]jira.Issue, error) {
+	var chunks [][]string
+	for start := 0; start < len(keys); start += parentChunk {
+		end := start + parentChunk
+		if end > len(keys) {
+			end = len(keys)
+		}
+		chunks = append(chunks, keys[start:end])
+	}
+
+	results := make([][]jira.Issue, len(chunks))
+	errs := make([]error, len(chunks))
+	runWorkers(len(chunks), concurrency, func(i int) {
+		errs[i] = jiraClient.Issue.SearchPages(fmt.Sprintf("key in (%s)", strings.Join(chunks[i], ",")), &jira.SearchOptions{
+			Fields:        fields,
+			ValidateQuery: "warn",
+		}, func(issue jira.Issue) error {
+			results[i] = append(results[i], issue)
+			return nil
+		})
+	})
+
+	issues := make(map[string]jira.Issue, len(keys))
+	var failed error
+	for i, chunk := range chunks {
+		if errs[i] != nil {
+			log.WithField("keys", strings.Join(chunk, ",")).WithError(errs[i]).Warn("Fail to get jira issues")
+			failed = errs[i]
+			continue
+		}
+		for _, issue := range results[i] {
+			issues[issue.Key] = issue
+		}
+	}
+	return issues, failed
+}
+
+func sumEpicPoints(epics map[string]epicPoints) (map[string]float64, int) {
+	storyPoints := make(map[string]float64)
+	unestimated := 0
+	for _, points := range epics {
+		for status, sp := range points.StoryPoints {
+			storyPoints[status] += sp
+		}
+		unestimated += points.Unestimated
+	}
+	return storyPoints, unestimated
+}
+
+func getParentMetric(level, name, key, summary string) *warp.GTS {
+	return warp.NewGTS(fmt.Sprintf("jerem.jira.%s.%s", level, name)).WithLabels(warp.Labels{
+		"key":     key,
+		"summary": summary,
+	})
+}
@@ -0,0 +1,202 @@
+package runner
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	warp "github.com/PierreZ/Warp10Exporter"
+	jira "github.com/andygrunwald/go-jira"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ovh/jerem/src/core"
+)
+
+func TestGetParentLink(t *testing.T) {
+	assert := require.New(t)
+
+	epic := jira.Issue{Fields: &jira.IssueFields{
+		Parent: &jira.Parent{Key: "INIT-1"},
+		Unknowns: map[string]interface{}{
+			"customfield_1": map[string]interface{}{"data": map[string]interface{}{"key": "INIT-2"}},
+			"customfield_2": "INIT-3",
+		},
+	}}
+
+	assert.Equal("", getParentLink(epic, ""))
+	assert.Equal("INIT-1", getParentLink(epic, core.ParentField))
+	assert.Equal("INIT-2", getParentLink(epic, "customfield_1"))
+	assert.Equal("INIT-3", getParentLink(epic, "customfield_2"))
+	assert.Equal("", getParentLink(epic, "customfield_3"))
+}
+
+func TestProcessInitiatives(t *testing.T) {
+	assert := require.New(t)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/rest/api/2/search", func(w http.ResponseWriter, r *http.Request) {
+		// Unknown keys are only warned
+		if r.URL.Query().Get("validateQuery") != "warn" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		switch r.URL.Query().Get("jql") {
+		case "key in (INIT-1,INIT-404)":
+			w.Write([]byte(`{"startAt": 0, "maxResults": 50, "total": 1, "issues": [
+				{"key": "INIT-1", "fields": {"summary": "Observability", "customfield_1": {"data": {"key": "THEME-1"}}}}
+			]}`))
+		case "key in (THEME-1)":
+			w.Write([]byte(`{"startAt": 0, "maxResults": 50, "total": 1, "issues": [{"key": "THEME-1", "fields": {"summary": "Reliability"}}]}`))
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	jiraClient, err := NewJiraClient(core.Jira{Auth: core.Auth{Type: core.AuthBasic}, URL: server.URL})
+	assert.NoError(err)
+
+	initiatives := map[string]map[string]epicPoints{
+		"INIT-1": {
+			"PJ1-1": {StoryPoints: map[string]float64{"total": 8, "done": 5, "indeterminate": 3}, Unestimated: 1},
+			"PJ2-1": {StoryPoints: map[string]float64{"total": 5, "done": 5}},
+		},
+		"INIT-404": {
+			"PJ1-2": {StoryPoints: map[string]float64{"total": 3}},
+		},
+	}
+
+	batch := warp.NewBatch()
+	assert.NoError(processInitiatives(jiraClient, initiatives, []string{"customfield_1"}, 2, batch))
+	assert.Len(*batch, 8)
+
+	gts := findSeries(batch, "jerem.jira.initiative.storypoint.done")
+	assert.NotNil(gts)
+	assert.Equal(map[string]string{"key": "INIT-1", "summary": "Observability"}, gts.Labels)
+	assert.Equal([]interface{}{10.0}, datapointValues(gts))
+	gts = findSeries(batch, "jerem.jira.initiative.storypoint")
+	assert.NotNil(gts)
+	assert.Equal([]interface{}{13.0}, datapointValues(gts))
+
+	// Themes sum the epics of their initiatives
+	gts = findSeries(batch, "jerem.jira.theme.storypoint")
+	assert.NotNil(gts)
+	assert.Equal(map[string]string{"key": "THEME-1", "summary": "Reliability"}, gts.Labels)
+	assert.Equal([]interface{}{13.0}, datapointValues(gts))
+}
+
+func TestGetIssuesByKey(t *testing.T) {
+	assert := require.New(t)
+
+	var requests int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/rest/api/2/search", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		jql := r.URL.Query().Get("jql")
+		if strings.Count(jql, ",") >= parentChunk {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		// The chunk of the last key fails
+		if strings.Contains(jql, "INIT-59") {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte(`{"startAt": 0, "maxResults": 50, "total": 1, "issues": [{"key": "INIT-0"}]}`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	jiraClient, err := NewJiraClient(core.Jira{Auth: core.Auth{Type: core.AuthBasic}, URL: server.URL})
+	assert.NoError(err)
+
+	var keys []string
+	for i := 0; i < 60; i++ {
+		keys = append(keys, fmt.Sprintf("INIT-%d", i))
+	}
+
+	issues, err := getIssuesByKey(jiraClient, keys, []string{"summary"}, 2)
+	assert.Error(err)
+	assert.Equal(int32(2), atomic.LoadInt32(&requests))
+	assert.Len(issues, 1)
+	assert.Contains(issues, "INIT-0")
+}
+
+func TestGetParentFields(t *testing.T) {
+	assert := require.New(t)
+
+	projects := []core.Project{
+		{Fields: core.Fields{ParentLink: "customfield_1"}},
+		{},
+		{Fields: core.Fields{ParentLink: core.ParentField}},
+		{Fields: core.Fields{ParentLink: "customfield_1"}},
+	}
+	assert.Equal([]string{"customfield_1", core.ParentField}, getParentFields(projects))
+}
+
+func TestEpicRunnerSkipInitiatives(t *testing.T) {
+	assert := require.New(t)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/rest/api/2/search", func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("jql") {
+		case "(project = \"PJ1\") AND issuetype = Epic":
+			w.Write([]byte(`{"startAt": 0, "maxResults": 50, "total": 1, "issues": [
+				{"key": "PJ1-1", "fields": {"parent": {"key": "INIT-1"}, "status": {"statusCategory": {"key": "indeterminate"}}}}
+			]}`))
+		case "parent in (PJ1-1)":
+			w.Write([]byte(`{"startAt": 0, "maxResults": 50, "total": 1, "issues": [
+				{"key": "PJ1-2", "fields": {"parent": {"key": "PJ1-1"}, "status": {"statusCategory": {"key": "done"}}, "customfield_10006": 5}}
+			]}`))
+		case "key in (INIT-1)":
+			w.Write([]byte(`{"startAt": 0, "maxResults": 50, "total": 1, "issues": [{"key": "INIT-1", "fields": {"summary": "Observability"}}]}`))
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	fields := core.Fields{StoryPoint: "customfield_10006", ParentLink: core.ParentField}
+	config := core.Config{
+		Jira: core.Jira{Auth: core.Auth{Type: core.AuthBasic}, URL: server.URL},
+		Projects: []core.Project{
+			{Name: "PJ1", Label: "PJ1", Fields: fields, EpicChildren: core.EpicChildrenParent},
+			{Name: "PJ2", Label: "PJ2", Fields: fields, EpicChildren: core.EpicChildrenParent},
+		},
+		Concurrency: 2,
+	}
+
+	// A failed project would lower the initiative totals
+	sink := &flakySink{}
+	assert.Error(EpicRunner(config, sink))
+	assert.Nil(findSeries(sink.last, "jerem.jira.initiative.storypoint"))
+	assert.Nil(findSeries(sink.last, "jerem.jira.theme.storypoint"))
+
+	// So would a filtered project list
+	config.Projects = config.Projects[:1]
+	config.Partial = true
+	assert.NoError(EpicRunner(config, sink))
+	assert.Nil(findSeries(sink.last, "jerem.jira.initiative.storypoint"))
+
+	config.Partial = false
+	assert.NoError(EpicRunner(config, sink))
+	gts := findSeries(sink.last, "jerem.jira.initiative.storypoint")
+	assert.NotNil(gts)
+	assert.Equal([]interface{}{5.0}, datapointValues(gts))
+}
+
+// findSeries return the series of a batch by class name, the batch keys
+// depend on the labels order
+func findSeries(batch *warp.Batch, classname string) *warp.GTS {
+	for _, gts := range *batch {
+		if gts.Classname == classname {
+			return gts
+		}
+	}
+	return nil
+}
@@ -0,0 +1,217 @@
+package runner
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	warp "github.com/PierreZ/Warp10Exporter"
+	jira "github.com/andygrunwald/go-jira"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/ovh/jerem/src/core"
+)
+
+// Days of throughput and arrival history, rounded to full weeks
+var kanbanDays = 28
+
+// getProjectMode return the project mode, detected from its board type when
+// not configured
+func getProjectMode(jiraClient *jira.Client, project core.Project) (string, error) {
+	if project.Mode != "" {
+		return project.Mode, nil
+	}
+
+	board, _, err := jiraClient.Board.GetBoard(project.Board)
+	if err != nil {
+		return "", err
+	}
+	if board.Type == core.ModeKanban {
+		return core.ModeKanban, nil
+	}
+	return core.ModeScrum, nil
+}
+
+// processKanban register the kanban metrics of a project: work in progress
+// and aging per column, throughput and arrival rate per day and per week
+func processKanban(jiraClient *jira.Client, project core.Project, categories map[string]string, batch *warp.Batch, now time.Time) error {
+	boardConfig, _, err := jiraClient.Board.GetBoardConfiguration(project.Board)
+	if err != nil {
+		log.WithField("project", project.Name).WithError(err).Warn("Fail to get board configuration")
+		return err
+	}
+	columns := boardConfig.ColumnConfig.Columns
+
+	// Work in progress, only the issues displayed in a board column are
+	// expanded with their changelog
+	var wip []jira.Issue
+	if query := getWipQuery(project, columns); query != "" {
+		err = jiraClient.Issue.SearchPages(query, &jira.SearchOptions{
+			Fields: []string{"id", "key", "created", "status", project.Fields.StoryPoint},
+			Expand: "changelog",
+		}, func(issue jira.Issue) error {
+			wip = append(wip, issue)
+			return nil
+		})
+		if err != nil {
+			log.WithField("project", project.Name).WithError(err).Warn("Fail to get work in progress")
+			return err
+		}
+	}
+
+	counts, storyPoints := computeColumns(wip, columns, project.Fields.StoryPoint)
+	ages := computeAging(wip, columns, categories, now)
+	for _, column := range columns {
+		batch.Register(getKanbanColumnMetric("wip.count", project.Label, column.Name).AddDatapoint(now, counts[column.Name]))
+		batch.Register(getKanbanColumnMetric("wip.storypoint", project.Label, column.Name).AddDatapoint(now, storyPoints[column.Name]))
+
+		values := ages[column.Name]
+		if len(values) == 0 {
+			continue
+		}
+		for _, p := range flowPercentiles {
+			batch.Register(getKanbanColumnMetric(fmt.Sprintf("aging.%s", p.name), project.Label, column.Name).AddDatapoint(now, percentile(values, p.value)))
+		}
+		batch.Register(getKanbanColumnMetric("aging.max", project.Label, column.Name).AddDatapoint(now, percentile(values, 1)))
+	}
+
+	// Throughput and arrival rate since the first monday of the window
+	since := getKanbanStart(now, kanbanDays)
+
+	resolved, err := getKanbanDates(jiraClient, fmt.Sprintf("(project = \"%s\" %s) AND statusCategory = Done AND resolved >= \"%s\"", project.Name, project.Jql, since.Format("2006-01-02")), func(issue jira.Issue) time.Time {
+		return time.Time(issue.Fields.Resolutiondate)
+	})
+	if err != nil {
+		log.WithField("project", project.Name).WithError(err).Warn("Fail to get resolved issues")
+		return err
+	}
+	registerKanbanRate(batch, "throughput", resolved, since, now, project.Label)
+
+	created, err := getKanbanDates(jiraClient, fmt.Sprintf("(project = \"%s\" %s) AND created >= \"%s\"", project.Name, project.Jql, since.Format("2006-01-02")), func(issue jira.Issue) time.Time {
+		return time.Time(issue.Fields.Created)
+	})
+	if err != nil {
+		log.WithField("project", project.Name).WithError(err).Warn("Fail to get created issues")
+		return err
+	}
+	registerKanbanRate(batch, "arrival", created, since, now, project.Label)
+
+	return nil
+}
+
+func getKanbanDates(jiraClient *jira.Client, jql string, date func(jira.Issue) time.Time) ([]time.Time, error) {
+	var dates []time.Time
+	err := jiraClient.Issue.SearchPages(jql, &jira.SearchOptions{
+		Fields: []string{"id", "key", "created", "resolutiondate"},
+	}, func(issue jira.Issue) error {
+		if d := date(issue); !d.IsZero() {
+			dates = append(dates, d)
+		}
+		return nil
+	})
+	return dates, err
+}
+
+// getKanbanStart return the monday starting the window of the given days
+func getKanbanStart(now time.Time, days int) time.Time {
+	start := now.UTC().Truncate(24*time.Hour).AddDate(0, 0, 1-days)
+	for start.Weekday() != time.Monday {
+		start = start.AddDate(0, 0, -1)
+	}
+	return start
+}
+
+// getWipQuery return the JQL searching the work in progress of a board, the
+// undone issues with a status mapped to a column. It is empty when no status
+// is mapped
+func getWipQuery(project core.Project, columns []jira.BoardConfigurationColumn) string {
+	var statuses []string
+	for status := range getStatusColumns(columns) {
+		statuses = append(statuses, status)
+	}
+	if len(statuses) == 0 {
+		return ""
+	}
+	sort.Strings(statuses)
+	return fmt.Sprintf("(project = \"%s\" %s) AND statusCategory != Done AND status in (%s)", project.Name, project.Jql, strings.Join(statuses, ","))
+}
+
+// computeAging return the age of each started issue per board column, from
+// its first transition to an indeterminate status
+func computeAging(issues []jira.Issue, columns []jira.BoardConfigurationColumn, categories map[string]string, now time.Time) map[string][]float64 {
+	statusColumns := getStatusColumns(columns)
+	ages := make(map[string][]float64)
+
+	for _, issue := range issues {
+		if issue.Fields == nil || issue.Fields.Status == nil {
+			continue
+		}
+		column, ok := statusColumns[issue.Fields.Status.ID]
+		if !ok || categories[strings.ToLower(issue.Fields.Status.Name)] != "indeterminate" {
+			continue
+		}
+
+		started := time.Time(issue.Fields.Created)
+		for _, transition := range getStatusTransitions(issue) {
+			if categories[strings.ToLower(transition.to)] == "indeterminate" {
+				started = transition.at
+				break
+			}
+		}
+		ages[column] = append(ages[column], now.Sub(started).Seconds())
+	}
+
+	return ages
+}
+
+// countPerPeriod count the dates per day and per week from the start date,
+// empty periods are counted as 0
+func countPerPeriod(dates []time.Time, since, now time.Time) ([]timePoint, []timePoint) {
+	var daily, weekly []timePoint
+	for day := since; !day.After(now); day = day.AddDate(0, 0, 1) {
+		daily = append(daily, timePoint{At: day})
+		if day.Weekday() == time.Monday {
+			weekly = append(weekly, timePoint{At: day})
+		}
+	}
+
+	for _, date := range dates {
+		date = date.UTC()
+		if date.Before(since) {
+			continue
+		}
+		if i := int(date.Sub(since) / (24 * time.Hour)); i < len(daily) {
+			daily[i].Value++
+		}
+		if i := int(date.Sub(since) / (7 * 24 * time.Hour)); i < len(weekly) {
+			weekly[i].Value++
+		}
+	}
+
+	return daily, weekly
+}
+
+func registerKanbanRate(batch *warp.Batch, name string, dates []time.Time, since, now time.Time, projectLabel string) {
+	daily, weekly := countPerPeriod(dates, since, now)
+	for period, points := range map[string][]timePoint{"day": daily, "week": weekly} {
+		gts := getKanbanMetric(name, projectLabel)
+		gts.Labels["period"] = period
+		for _, point := range points {
+			gts.AddDatapoint(point.At, point.Value)
+		}
+		batch.Register(gts)
+	}
+}
+
+func getKanbanMetric(name, projectLabel string) *warp.GTS {
+	return warp.NewGTS(fmt.Sprintf("jerem.jira.kanban.%s", name)).WithLabels(warp.Labels{
+		"project": projectLabel,
+	})
+}
+
+func getKanbanColumnMetric(name, projectLabel, column string) *warp.GTS {
+	gts := getKanbanMetric(name, projectLabel)
+	gts.Labels["column"] = column
+	return gts
+}
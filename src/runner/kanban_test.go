@@ -0,0 +1,100 @@
+package runner
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	jira "github.com/andygrunwald/go-jira"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ovh/jerem/src/core"
+)
+
+func TestGetProjectMode(t *testing.T) {
+	assert := require.New(t)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/rest/agile/1.0/board/1", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"id": 1, "type": "kanban"}`))
+	})
+	mux.HandleFunc("/rest/agile/1.0/board/2", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"id": 2, "type": "simple"}`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	jiraClient, err := NewJiraClient(core.Jira{Auth: core.Auth{Type: core.AuthBasic}, URL: server.URL})
+	assert.NoError(err)
+
+	mode, err := getProjectMode(jiraClient, core.Project{Board: 1})
+	assert.NoError(err)
+	assert.Equal(core.ModeKanban, mode)
+
+	mode, err = getProjectMode(jiraClient, core.Project{Board: 2})
+	assert.NoError(err)
+	assert.Equal(core.ModeScrum, mode)
+
+	// A configured mode is not detected
+	mode, err = getProjectMode(jiraClient, core.Project{Board: 1, Mode: core.ModeScrum})
+	assert.NoError(err)
+	assert.Equal(core.ModeScrum, mode)
+}
+
+func TestCountPerPeriod(t *testing.T) {
+	assert := require.New(t)
+
+	// Wednesday
+	now := time.Date(2020, 1, 15, 12, 0, 0, 0, time.UTC)
+	since := getKanbanStart(now, 7)
+	assert.Equal(time.Date(2020, 1, 6, 0, 0, 0, 0, time.UTC), since)
+
+	dates := []time.Time{
+		time.Date(2020, 1, 1, 10, 0, 0, 0, time.UTC),
+		time.Date(2020, 1, 6, 10, 0, 0, 0, time.UTC),
+		time.Date(2020, 1, 6, 15, 0, 0, 0, time.UTC),
+		time.Date(2020, 1, 12, 23, 0, 0, 0, time.UTC),
+		time.Date(2020, 1, 15, 9, 0, 0, 0, time.UTC),
+	}
+	daily, weekly := countPerPeriod(dates, since, now)
+	assert.Equal([]float64{2, 0, 0, 0, 0, 0, 1, 0, 0, 1}, timePointValues(daily))
+	assert.Equal([]float64{3, 1}, timePointValues(weekly))
+	assert.Equal(time.Date(2020, 1, 13, 0, 0, 0, 0, time.UTC), weekly[1].At)
+}
+
+func TestGetWipQuery(t *testing.T) {
+	assert := require.New(t)
+
+	project := core.Project{Name: "OPS", Jql: "AND component = api"}
+	columns := []jira.BoardConfigurationColumn{
+		{Name: "To Do", Status: []jira.BoardConfigurationColumnStatus{{ID: "1"}}},
+		{Name: "In Progress", Status: []jira.BoardConfigurationColumnStatus{{ID: "3"}, {ID: "10004"}}},
+		{Name: "Done"},
+	}
+	assert.Equal("(project = \"OPS\" AND component = api) AND statusCategory != Done AND status in (1,10004,3)", getWipQuery(project, columns))
+	assert.Equal("", getWipQuery(project, []jira.BoardConfigurationColumn{{Name: "Done"}}))
+}
+
+func TestComputeAging(t *testing.T) {
+	assert := require.New(t)
+
+	columns := []jira.BoardConfigurationColumn{
+		{Name: "To Do", Status: []jira.BoardConfigurationColumnStatus{{ID: "1"}}},
+		{Name: "In Progress", Status: []jira.BoardConfigurationColumnStatus{{ID: "3"}}},
+	}
+	created := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	issues := []jira.Issue{
+		{Fields: &jira.IssueFields{Created: jira.Time(created), Status: &jira.Status{ID: "1", Name: "To Do"}}},
+		{
+			Fields: &jira.IssueFields{Created: jira.Time(created), Status: &jira.Status{ID: "3", Name: "In Progress"}},
+			Changelog: &jira.Changelog{Histories: []jira.ChangelogHistory{
+				statusChange("2020-01-03T00:00:00.000+0000", "To Do", "In Progress"),
+			}},
+		},
+	}
+
+	now := time.Date(2020, 1, 5, 0, 0, 0, 0, time.UTC)
+	ages := computeAging(issues, columns, flowCategories, now)
+	assert.Equal(map[string][]float64{"In Progress": {(48 * time.Hour).Seconds()}}, ages)
+}
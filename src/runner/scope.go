@@ -0,0 +1,215 @@
+package runner
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	warp "github.com/PierreZ/Warp10Exporter"
+	jira "github.com/andygrunwald/go-jira"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/ovh/jerem/src/core"
+)
+
+// sprintChange is an issue added to or removed from a sprint
+type sprintChange struct {
+	at    time.Time
+	added bool
+}
+
+// sprintScope is the issues count and story points of a sprint scope change
+type sprintScope struct {
+	Count      int
+	StoryPoint float64
+}
+
+func (s *sprintScope) add(sp float64) {
+	s.Count++
+	s.StoryPoint += sp
+}
+
+// getSprintHistory return the sprint issues with their changelog, and the
+// issues updated since the sprint start which may have been removed from it
+func getSprintHistory(jiraClient *jira.Client, sprint jira.Sprint, project core.Project) ([]jira.Issue, []jira.Issue, error) {
+	issues, err := getSprintChangelogIssues(jiraClient, project, sprint.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Removed issues are no more in the sprint, look for them in the
+	// issues which were in it and updated since the sprint start
+	var others []jira.Issue
+	err = jiraClient.Issue.SearchPages(getRemovedIssuesQuery(project, sprint), &jira.SearchOptions{
+		Fields: []string{"id", "key", "created", "status", project.Fields.StoryPoint},
+		Expand: "changelog",
+	}, func(issue jira.Issue) error {
+		others = append(others, issue)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return issues, others, nil
+}
+
+// getRemovedIssuesQuery return the JQL searching the issues removed from a
+// sprint. Jira reads the dates in the user timezone, the day before the
+// sprint start is searched to cover any of them
+func getRemovedIssuesQuery(project core.Project, sprint jira.Sprint) string {
+	return fmt.Sprintf("(project = \"%s\" %s) AND sprint was %d AND (sprint != %d OR sprint is EMPTY) AND updated >= \"%s\"", project.Name, project.Jql, sprint.ID, sprint.ID, sprint.StartDate.UTC().AddDate(0, 0, -1).Format("2006-01-02"))
+}
+
+// registerSprintScope register the sprint commitment at its start and the
+// issues added or removed since
+func registerSprintScope(batch *warp.Batch, scopes map[string]sprintScope, now time.Time, projectLabel, sprint string) {
+	for _, name := range []string{"committed", "added", "removed"} {
+		batch.Register(getSprintScopeMetric(name, projectLabel, sprint, "count").AddDatapoint(now, scopes[name].Count))
+		batch.Register(getSprintScopeMetric(name, projectLabel, sprint, "storypoint").AddDatapoint(now, scopes[name].StoryPoint))
+	}
+}
+
+// computeSprintScope compute the sprint commitment at its start, and the
+// issues added after its start or removed before its end. issues are in the
+// sprint, others may have been removed from it
+func computeSprintScope(issues, others []jira.Issue, sprint jira.Sprint, storyPointField string) map[string]sprintScope {
+	scopes := map[string]sprintScope{}
+	start := *sprint.StartDate
+	end := time.Now().UTC()
+	if sprint.EndDate != nil && sprint.EndDate.Before(end) {
+		end = *sprint.EndDate
+	}
+
+	walk := func(issue jira.Issue, inSprint bool) {
+		changes := getSprintChanges(issue, sprint.ID)
+		if !inSprint && len(changes) == 0 {
+			return
+		}
+
+		sp, err := getStoryPoints(storyPointField, issue)
+		if err != nil {
+			log.WithField("key", issue.Key).WithError(err).Warn("Fail to get story points")
+			return
+		}
+
+		if isInSprintAt(issue, changes, inSprint, start) {
+			scope := scopes["committed"]
+			scope.add(sp)
+			scopes["committed"] = scope
+		}
+
+		added, removed := false, false
+		for _, change := range changes {
+			if !change.at.After(start) || change.at.After(end) {
+				continue
+			}
+			if change.added {
+				added = true
+			} else {
+				removed = true
+			}
+		}
+		// Issues created in the sprint after its start have no change
+		if inSprint && len(changes) == 0 && time.Time(issue.Fields.Created).After(start) {
+			added = true
+		}
+
+		if added {
+			scope := scopes["added"]
+			scope.add(sp)
+			scopes["added"] = scope
+		}
+		if removed && !inSprint {
+			scope := scopes["removed"]
+			scope.add(sp)
+			scopes["removed"] = scope
+		}
+	}
+
+	for _, issue := range issues {
+		walk(issue, true)
+	}
+	for _, issue := range others {
+		walk(issue, false)
+	}
+
+	return scopes
+}
+
+// getSprintChanges return the issue additions and removals of the sprint
+// from the Sprint field changelog, sorted by date
+func getSprintChanges(issue jira.Issue, sprintID int) []sprintChange {
+	var changes []sprintChange
+	if issue.Changelog == nil {
+		return changes
+	}
+
+	for _, history := range issue.Changelog.Histories {
+		for _, item := range history.Items {
+			if item.Field != "Sprint" {
+				continue
+			}
+			from, to := hasSprint(item.From, sprintID), hasSprint(item.To, sprintID)
+			if from == to {
+				continue
+			}
+
+			at, err := history.CreatedTime()
+			if err != nil {
+				log.WithField("key", issue.Key).WithError(err).Warn("Fail to parse changelog date")
+				continue
+			}
+			changes = append(changes, sprintChange{at: at, added: to})
+		}
+	}
+	sort.SliceStable(changes, func(i, j int) bool {
+		return changes[i].at.Before(changes[j].at)
+	})
+	return changes
+}
+
+// isInSprintAt replay the sprint changes to know if the issue was in the
+// sprint at the given date, inSprint is the issue current membership
+func isInSprintAt(issue jira.Issue, changes []sprintChange, inSprint bool, at time.Time) bool {
+	if time.Time(issue.Fields.Created).After(at) {
+		return false
+	}
+
+	member := inSprint
+	if len(changes) > 0 {
+		member = !changes[0].added
+	}
+	for _, change := range changes {
+		if change.at.After(at) {
+			break
+		}
+		member = change.added
+	}
+	return member
+}
+
+// hasSprint check a Sprint field changelog value, a comma separated list
+// of sprint ids
+func hasSprint(value interface{}, sprintID int) bool {
+	ids, ok := value.(string)
+	if !ok {
+		return false
+	}
+	for _, id := range strings.Split(ids, ",") {
+		if strings.TrimSpace(id) == strconv.Itoa(sprintID) {
+			return true
+		}
+	}
+	return false
+}
+
+func getSprintScopeMetric(name, projectLabel, sprint, value string) *warp.GTS {
+	return warp.NewGTS(fmt.Sprintf("jerem.jira.sprint.scope.%s", name)).WithLabels(warp.Labels{
+		"project": projectLabel,
+		"sprint":  sprint,
+		"value":   value,
+	})
+}
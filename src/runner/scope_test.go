@@ -0,0 +1,111 @@
+package runner
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	warp "github.com/PierreZ/Warp10Exporter"
+	jira "github.com/andygrunwald/go-jira"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ovh/jerem/src/core"
+)
+
+func TestComputeSprintScope(t *testing.T) {
+	assert := require.New(t)
+
+	start := time.Date(2020, 1, 6, 9, 0, 0, 0, time.UTC)
+	end := time.Date(2020, 1, 17, 18, 0, 0, 0, time.UTC)
+	sprint := jira.Sprint{ID: 12, StartDate: &start, EndDate: &end}
+
+	created := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	issues := []jira.Issue{
+		// Committed
+		velocityIssue(created, 3, sprintFieldChange("2020-01-03T00:00:00.000+0000", "", "12")),
+		// Created in the sprint before its start
+		velocityIssue(created, 5),
+		// Added during the sprint
+		velocityIssue(created, 2, sprintFieldChange("2020-01-08T00:00:00.000+0000", "", "12")),
+		// Created in the sprint after its start
+		velocityIssue(time.Date(2020, 1, 9, 0, 0, 0, 0, time.UTC), 1),
+	}
+	others := []jira.Issue{
+		// Committed then removed
+		velocityIssue(created, 8,
+			sprintFieldChange("2020-01-03T00:00:00.000+0000", "", "12"),
+			sprintFieldChange("2020-01-10T00:00:00.000+0000", "12", "13"),
+		),
+		// Added then removed
+		velocityIssue(created, 13,
+			sprintFieldChange("2020-01-07T00:00:00.000+0000", "", "12"),
+			sprintFieldChange("2020-01-10T00:00:00.000+0000", "12", ""),
+		),
+		// Never in the sprint
+		velocityIssue(created, 21, sprintFieldChange("2020-01-07T00:00:00.000+0000", "", "13")),
+	}
+
+	scopes := computeSprintScope(issues, others, sprint, "customfield_10006")
+	assert.Equal(map[string]sprintScope{
+		"committed": {Count: 3, StoryPoint: 16},
+		"added":     {Count: 3, StoryPoint: 16},
+		"removed":   {Count: 2, StoryPoint: 21},
+	}, scopes)
+}
+
+func TestHasSprint(t *testing.T) {
+	assert := require.New(t)
+
+	assert.True(hasSprint("11, 12", 12))
+	assert.False(hasSprint("112", 12))
+	assert.False(hasSprint(nil, 12))
+}
+
+func TestGetRemovedIssuesQuery(t *testing.T) {
+	assert := require.New(t)
+
+	start := time.Date(2020, 1, 6, 0, 30, 0, 0, time.UTC)
+	sprint := jira.Sprint{ID: 12, StartDate: &start}
+	project := core.Project{Name: "K8S", Jql: "AND component = api"}
+	assert.Equal("(project = \"K8S\" AND component = api) AND sprint was 12 AND (sprint != 12 OR sprint is EMPTY) AND updated >= \"2020-01-05\"", getRemovedIssuesQuery(project, sprint))
+}
+
+func TestProcessSprintWithoutChangelog(t *testing.T) {
+	assert := require.New(t)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/rest/agile/1.0/sprint/5/issue", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"issues": []}`))
+	})
+	mux.HandleFunc("/rest/api/2/search", func(w http.ResponseWriter, r *http.Request) {
+		// Only the changelog search fails
+		if !strings.Contains(r.URL.Query().Get("jql"), "Impediment") {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(`{"startAt": 0, "maxResults": 50, "total": 0, "issues": []}`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	jiraClient, err := NewJiraClient(core.Jira{Auth: core.Auth{Type: core.AuthBasic}, URL: server.URL})
+	assert.NoError(err)
+
+	start := time.Date(2020, 1, 6, 9, 0, 0, 0, time.UTC)
+	end := time.Date(2020, 1, 17, 18, 0, 0, 0, time.UTC)
+	sprint := jira.Sprint{ID: 5, Name: "Sprint 5", StartDate: &start, EndDate: &end}
+	project := core.Project{Name: "K8S", Label: "K8S"}
+
+	batch := warp.NewBatch()
+	err = processSprint(jiraClient, sprint, project, batch, "(Done)", flowCategories, core.Burndown{})
+	assert.Error(err)
+
+	// The scope and burndown series are skipped, the others are registered
+	assert.NotNil(findSeries(batch, "jerem.jira.sprint.storypoint.total"))
+	assert.NotNil(findSeries(batch, "jerem.jira.sprint.events"))
+	assert.NotNil(findSeries(batch, "jerem.jira.impediment.total.count"))
+	assert.Nil(findSeries(batch, "jerem.jira.sprint.burndown.ideal"))
+	assert.Nil(findSeries(batch, "jerem.jira.sprint.scope.committed"))
+}
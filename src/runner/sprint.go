@@ -1,10 +1,10 @@
 package runner
 
 import (
-	"bytes"
 	"fmt"
 	"net/url"
 	"strings"
+	"sync"
 	"time"
 
 	warp "github.com/PierreZ/Warp10Exporter"
@@ -13,73 +13,129 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
-const impedimentField = "customfield_11028"
-
-// SprintRunner runner handling sprint metrics
-func SprintRunner(config core.Config) {
-	tp := jira.BasicAuthTransport{
-		Username: config.Jira.Username,
-		Password: config.Jira.Password,
-	}
-	jiraClient, err := jira.NewClient(tp.Client(), config.Jira.URL)
+// SprintRunner runner handling sprint metrics, or kanban metrics for kanban
+// boards. It returns an error when a project couldn't be collected or the
+// metrics couldn't be pushed
+func SprintRunner(config core.Config, sink core.Sink) error {
+	jiraClient, err := NewJiraClient(config.Jira)
 	if err != nil {
 		log.WithError(err).Error("Fail to get jira client")
-		return
+		return err
 	}
 
-	batch := warp.NewBatch()
+	// Statuses are only requested by the series needing their category
+	categories := &statusCategories{jiraClient: jiraClient}
+
+	log.Debug(config.Jira.ClosedStatuses)
+	closed := fmt.Sprintf("(%s)", strings.Join(config.Jira.ClosedStatuses, ","))
+
+	batch, failed := collectProjects(config.Projects, config.Concurrency, func(project core.Project, batch *warp.Batch) error {
+		return processSprintProject(jiraClient, project, config, closed, categories, batch)
+	})
+
+	return runnerError(failed, pushBatch(sink, "sprint", batch))
+}
 
-	for _, project := range config.Projects {
+// processSprintProject register the sprint or kanban metrics of a project,
+// and its impediments. It returns an error when a part couldn't be collected
+func processSprintProject(jiraClient *jira.Client, project core.Project, config core.Config, closed string, categories *statusCategories, batch *warp.Batch) error {
+	mode, err := getProjectMode(jiraClient, project)
+	if err != nil {
+		log.WithField("project", project.Name).WithError(err).Warn("Fail to get board type")
+		return err
+	}
+
+	var failed error
+
+	if mode == core.ModeKanban {
+		// Kanban boards have no sprint, the aging series are skipped without
+		// status categories
+		statuses, err := categories.get()
+		if err != nil {
+			failed = err
+		}
+		if err := processKanban(jiraClient, project, statuses, batch, time.Now().UTC()); err != nil {
+			failed = err
+		}
+	} else {
 		options := &jira.GetAllSprintsOptions{State: "active"}
 		sprints, _, err := jiraClient.Board.GetAllSprintsWithOptions(project.Board, options)
 		if err != nil {
 			log.WithField("project", project.Name).WithError(err).Warn("Fail to get sprints")
-			continue
+			return err
 		}
 
-		log.Debug(config.Jira.ClosedStatuses)
-		closed := fmt.Sprintf("(%s)", strings.Join(config.Jira.ClosedStatuses, ","))
-
 		for _, sprint := range sprints.Values {
-			processSprint(jiraClient, sprint, project, batch, closed)
+			// The remaining burndown is skipped without status categories
+			statuses, err := categories.get()
+			if err != nil {
+				failed = err
+			}
+			if err := processSprint(jiraClient, sprint, project, batch, closed, statuses, config.Burndown); err != nil {
+				failed = err
+			}
 		}
 
-		// Get last day closed impediment and set issue timespent at its creation date
-		var closedImpediments []jira.Issue
-
-		err = jiraClient.Issue.SearchPages(fmt.Sprintf("(project = \"%s\" %s) AND status in %s AND labels in (Impediment, impediment) AND updated >= -1d AND timespent is not EMPTY", project.Name, project.Jql, closed), &jira.SearchOptions{
-			Fields: []string{"id", "key", "project", "created", "timespent"},
-		}, func(issue jira.Issue) error {
-			closedImpediments = append(closedImpediments, issue)
-			return nil
-		})
-		if err != nil {
-			log.WithField("project", project.Name).WithError(err).Warn("Fail to get sprint issues")
-			return
+		// The velocity series are skipped without status categories
+		if config.Velocity.Sprints > 0 {
+			statuses, err := categories.get()
+			if err != nil {
+				failed = err
+			} else if err := processVelocity(jiraClient, project, config.Velocity, statuses, sprints.Values, batch); err != nil {
+				failed = err
+			}
 		}
+	}
 
-		if len(closedImpediments) > 0 {
-			gts := warp.NewGTS(fmt.Sprintf("jerem.jira.impediment.total.created")).WithLabels(warp.Labels{
-				"project": project.Label,
-				"type":    "daily",
-				"value":   "timespent",
-			})
-			for _, impediment := range closedImpediments {
-				gts.AddDatapoint(time.Time(impediment.Fields.Created), impediment.Fields.TimeSpent)
-			}
-			batch.Register(gts)
+	// Get last day closed impediment and set issue timespent at its creation date
+	var closedImpediments []jira.Issue
+
+	err = jiraClient.Issue.SearchPages(fmt.Sprintf("(project = \"%s\" %s) AND status in %s AND labels in (Impediment, impediment) AND updated >= -1d AND timespent is not EMPTY", project.Name, project.Jql, closed), &jira.SearchOptions{
+		Fields: []string{"id", "key", "project", "created", "timespent"},
+	}, func(issue jira.Issue) error {
+		closedImpediments = append(closedImpediments, issue)
+		return nil
+	})
+	if err != nil {
+		log.WithField("project", project.Name).WithError(err).Warn("Fail to get sprint issues")
+		return err
+	}
+
+	if len(closedImpediments) > 0 {
+		gts := warp.NewGTS(fmt.Sprintf("jerem.jira.impediment.total.created")).WithLabels(warp.Labels{
+			"project": project.Label,
+			"type":    "daily",
+			"value":   "timespent",
+		})
+		for _, impediment := range closedImpediments {
+			gts.AddDatapoint(time.Time(impediment.Fields.Created), impediment.Fields.TimeSpent)
 		}
+		batch.Register(gts)
 	}
 
-	var b bytes.Buffer
-	batch.Print(&b)
-	log.Debug(b.String())
-	if len(*batch) != 0 {
-		err = batch.Push(config.Metrics.URL, config.Metrics.Token)
+	return failed
+}
+
+// statusCategories load the status categories on first use, once per run
+type statusCategories struct {
+	jiraClient *jira.Client
+	once       sync.Once
+	categories map[string]string
+	err        error
+}
+
+// get return the category key of each lowercased status name
+func (s *statusCategories) get() (map[string]string, error) {
+	s.once.Do(func() {
+		statuses, _, err := s.jiraClient.Status.GetAllStatuses()
 		if err != nil {
-			log.WithError(err).Error("Fail to push metrics")
+			log.WithError(err).Error("Fail to get statuses")
+			s.err = err
+			return
 		}
-	}
+		s.categories = getStatusCategories(statuses)
+	})
+	return s.categories, s.err
 }
 
 func getSprintMetric(name string, projectLabel, sprint string) *warp.GTS {
@@ -138,7 +194,7 @@ func GetIssuesForSprint(jiraClient *jira.Client, sprintID int, jql string) ([]ji
 	return jiraClient.Sprint.GetIssuesForSprint(sprintID)
 }
 
-func processSprint(jiraClient *jira.Client, sprint jira.Sprint, project core.Project, batch *warp.Batch, jiraCloseStatus string) {
+func processSprint(jiraClient *jira.Client, sprint jira.Sprint, project core.Project, batch *warp.Batch, jiraCloseStatus string, categories map[string]string, burndown core.Burndown) error {
 	jql := ""
 	if project.Jql != "" {
 		jql = fmt.Sprintf("project=%s %s", project.Name, project.Jql)
@@ -147,10 +203,10 @@ func processSprint(jiraClient *jira.Client, sprint jira.Sprint, project core.Pro
 	if err != nil {
 		log.WithFields(log.Fields{"sprint": sprint.Name, "project": project.Label}).
 			WithError(err).Warn("Fail to get issue for sprint")
-		return
+		return err
 	}
 
-	storyPoints, _, _ := computeStoryPoints(issues, storyPointField)
+	storyPoints, _, _ := computeStoryPoints(issues, project.Fields.StoryPoint)
 
 	// Gen metrics
 	now := time.Now().UTC()
@@ -167,6 +223,10 @@ func processSprint(jiraClient *jira.Client, sprint jira.Sprint, project core.Pro
 	gts = getSprintMetric("storypoint.done", project.Label, sprint.Name).AddDatapoint(now, storyPoints["done"])
 	batch.Register(gts)
 
+	// Scope and burndown series are skipped when the changelog is missing,
+	// the other sprint series are still registered
+	failed := processSprintScope(jiraClient, sprint, project, batch, categories, burndown, now)
+
 	// Add start and end date in sprint events series
 	gts = getSprintMetric("events", project.Label, "current").AddDatapoint(*sprint.StartDate, "start").AddDatapoint(*sprint.EndDate, "end")
 	batch.Register(gts)
@@ -176,7 +236,7 @@ func processSprint(jiraClient *jira.Client, sprint jira.Sprint, project core.Pro
 	// Get current sprint closed impediments
 	var impediments []jira.Issue
 	err = jiraClient.Issue.SearchPages(fmt.Sprintf("(project = \"%s\" %s) AND status in %s AND labels in (Impediment, impediment) AND updated >= %s AND updated <= %s AND timespent is not EMPTY", project.Name, project.Jql, jiraCloseStatus, sprint.StartDate.Format("2006-01-02"), sprint.EndDate.Format("2006-01-02")), &jira.SearchOptions{
-		Fields: []string{"id", "key", "project", "labels", "summary", "status", "timespent", impedimentField},
+		Fields: []string{"id", "key", "project", "labels", "summary", "status", "timespent", project.Fields.Impediment},
 	}, func(issue jira.Issue) error {
 		impediments = append(impediments, issue)
 		return nil
@@ -184,13 +244,13 @@ func processSprint(jiraClient *jira.Client, sprint jira.Sprint, project core.Pro
 	if err != nil {
 		log.WithFields(log.Fields{"sprint": sprint.Name, "project": project.Label}).
 			WithError(err).Warn("Fail to get sprint issues")
-		return
+		return err
 	}
 
 	impedimentCount := make(map[string]int)
 	impedimentSecond := make(map[string]int)
 	for _, impediment := range impediments {
-		impedimentType, err := getImpedimentType(impedimentField, impediment)
+		impedimentType, err := getImpedimentType(project.Fields.Impediment, impediment)
 		if err != nil {
 			log.WithField("key", impediment.Key).WithError(err).Warn("Fail to get impediment type")
 			continue
@@ -222,4 +282,30 @@ func processSprint(jiraClient *jira.Client, sprint jira.Sprint, project core.Pro
 		gts = getImpedimentSprintMetric(fmt.Sprintf("%s.timespent", impedimentType), project.Label, sprint.Name).AddDatapoint(now, v)
 		batch.Register(gts)
 	}
+
+	return failed
+}
+
+// processSprintScope register the sprint commitment, scope changes and
+// burndown from the issues changelog
+func processSprintScope(jiraClient *jira.Client, sprint jira.Sprint, project core.Project, batch *warp.Batch, categories map[string]string, burndown core.Burndown, now time.Time) error {
+	sprintIssues, others, err := getSprintHistory(jiraClient, sprint, project)
+	if err != nil {
+		log.WithFields(log.Fields{"sprint": sprint.Name, "project": project.Label}).
+			WithError(err).Warn("Fail to get sprint issues changelog")
+		return err
+	}
+
+	scopes := computeSprintScope(sprintIssues, others, sprint, project.Fields.StoryPoint)
+	registerSprintScope(batch, scopes, now, project.Label, "current")
+	registerSprintScope(batch, scopes, now, project.Label, sprint.Name)
+
+	var remaining []timePoint
+	if categories != nil {
+		remaining = computeBurndown(sprintIssues, others, sprint, categories, project.Fields.StoryPoint, now)
+	}
+	ideal := computeIdealBurndown(sprint, scopes["committed"].StoryPoint, burndown)
+	registerBurndown(batch, remaining, ideal, project.Label, "current")
+	registerBurndown(batch, remaining, ideal, project.Label, sprint.Name)
+	return nil
 }
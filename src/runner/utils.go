@@ -1,8 +1,16 @@
 package runner
 
 import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+
+	warp "github.com/PierreZ/Warp10Exporter"
 	jira "github.com/andygrunwald/go-jira"
 	log "github.com/sirupsen/logrus"
+
+	"github.com/ovh/jerem/src/core"
 )
 
 var dependencyLabel = "dependency"
@@ -51,3 +59,84 @@ func getStoryPoints(field string, issue jira.Issue) (float64, error) {
 	}
 	return sp, nil
 }
+
+// runWorkers call work for each index below n, with at most concurrency
+// calls at once, and return once they are all done
+func runWorkers(n, concurrency int, work func(i int)) {
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < concurrency && w < n; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				work(i)
+			}
+		}()
+	}
+
+	for i := 0; i < n; i++ {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+}
+
+// collectProjects run collect on the projects with a pool of concurrency
+// workers. Each project registers its series in its own batch, merged in
+// the returned run batch, and the failed projects are returned in the
+// config order
+func collectProjects(projects []core.Project, concurrency int, collect func(project core.Project, batch *warp.Batch) error) (*warp.Batch, []string) {
+	batches := make([]*warp.Batch, len(projects))
+	errs := make([]error, len(projects))
+
+	runWorkers(len(projects), concurrency, func(i int) {
+		batches[i] = warp.NewBatch()
+		errs[i] = collect(projects[i], batches[i])
+	})
+
+	batch := warp.NewBatch()
+	var failed []string
+	for i, project := range projects {
+		for _, gts := range *batches[i] {
+			batch.Register(gts)
+		}
+		if errs[i] != nil {
+			failed = append(failed, project.Name)
+		}
+	}
+	return batch, failed
+}
+
+// pushBatch send a runner batch to the metrics sink
+func pushBatch(sink core.Sink, runner string, batch *warp.Batch) error {
+	var b bytes.Buffer
+	batch.Print(&b)
+	log.Debug(b.String())
+
+	err := sink.Write(runner, batch)
+	if err != nil {
+		log.WithError(err).Error("Fail to push metrics")
+	}
+	return err
+}
+
+// runnerError summarize the failures of a run
+func runnerError(failed []string, pushErr error) error {
+	var errs []string
+	if len(failed) > 0 {
+		errs = append(errs, fmt.Sprintf("fail to collect projects %s", strings.Join(failed, ", ")))
+	}
+	if pushErr != nil {
+		errs = append(errs, fmt.Sprintf("fail to push metrics: %s", pushErr))
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, ", "))
+	}
+	return nil
+}
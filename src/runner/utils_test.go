@@ -0,0 +1,65 @@
+package runner
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	warp "github.com/PierreZ/Warp10Exporter"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ovh/jerem/src/core"
+)
+
+func TestRunnerError(t *testing.T) {
+	assert := require.New(t)
+
+	assert.NoError(runnerError(nil, nil))
+	assert.EqualError(runnerError([]string{"K8S", "OB"}, nil), "fail to collect projects K8S, OB")
+	assert.EqualError(runnerError([]string{"K8S"}, fmt.Errorf("unavailable")), "fail to collect projects K8S, fail to push metrics: unavailable")
+}
+func TestRunWorkers(t *testing.T) {
+	assert := require.New(t)
+
+	var mutex sync.Mutex
+	running, maxRunning := 0, 0
+	done := make([]bool, 10)
+	runWorkers(len(done), 3, func(i int) {
+		mutex.Lock()
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		mutex.Unlock()
+
+		time.Sleep(10 * time.Millisecond)
+		done[i] = true
+
+		mutex.Lock()
+		running--
+		mutex.Unlock()
+	})
+
+	assert.Equal(3, maxRunning)
+	for _, d := range done {
+		assert.True(d)
+	}
+}
+func TestCollectProjects(t *testing.T) {
+	assert := require.New(t)
+
+	projects := []core.Project{{Name: "K8S", Label: "K8S"}, {Name: "OB", Label: "OB"}, {Name: "PJ1", Label: "PJ1"}}
+	now := time.Now().UTC()
+
+	batch, failed := collectProjects(projects, 2, func(project core.Project, batch *warp.Batch) error {
+		batch.Register(getSprintMetric("storypoint.total", project.Label, "current").AddDatapoint(now, 1.0))
+		if project.Name != "OB" {
+			return nil
+		}
+		return fmt.Errorf("unavailable")
+	})
+
+	assert.Equal([]string{"OB"}, failed)
+	assert.Len(*batch, 3)
+}
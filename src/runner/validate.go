@@ -0,0 +1,182 @@
+package runner
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	jira "github.com/andygrunwald/go-jira"
+
+	"github.com/ovh/jerem/src/core"
+)
+
+// Check is the result of a single validation check, Err is nil on success
+type Check struct {
+	Name string
+	Err  error
+}
+
+// Report group the validation checks of a config item
+type Report struct {
+	Name   string
+	Checks []Check
+}
+
+// Failed return true when one of the report checks failed
+func (r Report) Failed() bool {
+	for _, check := range r.Checks {
+		if check.Err != nil {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Report) add(name string, err error) {
+	r.Checks = append(r.Checks, Check{Name: name, Err: err})
+}
+
+type boardProjects struct {
+	Values []jira.Project `json:"values"`
+}
+
+type searchResult struct {
+	Total int `json:"total"`
+}
+
+// ValidateConfig check the config against the live Jira: projects, boards,
+// JQL filters, custom fields and closed statuses. It returns a report for
+// jira and one per project
+func ValidateConfig(config core.Config) ([]Report, error) {
+	jiraClient, err := NewJiraClient(config.Jira)
+	if err != nil {
+		return nil, err
+	}
+
+	jiraReport := Report{Name: fmt.Sprintf("Jira %s", config.Jira.URL)}
+
+	fields, _, err := jiraClient.Field.GetList()
+	if err != nil {
+		jiraReport.add("list fields", fmt.Errorf("%s: check the jira url and credentials", err))
+		return []Report{jiraReport}, nil
+	}
+	checkFields(&jiraReport, fields, config.Jira.Fields)
+
+	statuses, _, err := jiraClient.Status.GetAllStatuses()
+	if err != nil {
+		jiraReport.add("list statuses", err)
+	} else {
+		for _, closed := range config.Jira.ClosedStatuses {
+			jiraReport.add(fmt.Sprintf("closed status %s exists", closed), checkStatus(statuses, closed))
+		}
+	}
+
+	projects, _, err := jiraClient.Project.GetList()
+	if err != nil {
+		jiraReport.add("list projects", err)
+		return []Report{jiraReport}, nil
+	}
+
+	reports := []Report{jiraReport}
+	for _, project := range config.Projects {
+		report := validateProject(jiraClient, *projects, project)
+		if project.Fields != config.Jira.Fields {
+			checkFields(&report, fields, project.Fields)
+		}
+		reports = append(reports, report)
+	}
+
+	return reports, nil
+}
+
+func validateProject(jiraClient *jira.Client, projects jira.ProjectList, project core.Project) Report {
+	report := Report{Name: fmt.Sprintf("Project %s (board %d)", project.Label, project.Board)}
+
+	key := ""
+	for _, p := range projects {
+		if strings.EqualFold(p.Key, project.Name) || p.Name == project.Name {
+			key = p.Key
+			break
+		}
+	}
+	if key == "" {
+		report.add(fmt.Sprintf("project %s exists", project.Name), fmt.Errorf("no visible project with key or name '%s': check the project name and the jira user permissions", project.Name))
+	} else {
+		report.add(fmt.Sprintf("project %s exists", project.Name), nil)
+	}
+
+	report.add(fmt.Sprintf("board %d belongs to project %s", project.Board, project.Name), checkBoard(jiraClient, project.Board, key))
+
+	if project.Jql != "" {
+		report.add("jql filter is valid", checkJql(jiraClient, fmt.Sprintf("project = \"%s\" %s", project.Name, project.Jql)))
+	}
+
+	return report
+}
+
+func checkFields(report *Report, fields []jira.Field, configured core.Fields) {
+	_, err := resolveField(fields, configured.StoryPoint)
+	if err != nil {
+		err = fmt.Errorf("%s: check the field id or name in the jira custom fields administration", err)
+	}
+	report.add(fmt.Sprintf("story point field %s exists", configured.StoryPoint), err)
+
+	_, err = resolveField(fields, configured.Impediment)
+	if err != nil {
+		err = fmt.Errorf("%s: check the field id or name in the jira custom fields administration", err)
+	}
+	report.add(fmt.Sprintf("impediment field %s exists", configured.Impediment), err)
+
+	if configured.ParentLink != "" && configured.ParentLink != core.ParentField {
+		_, err = resolveField(fields, configured.ParentLink)
+		if err != nil {
+			err = fmt.Errorf("%s: check the field id or name in the jira custom fields administration", err)
+		}
+		report.add(fmt.Sprintf("parent link field %s exists", configured.ParentLink), err)
+	}
+}
+
+func checkStatus(statuses []jira.Status, name string) error {
+	for _, status := range statuses {
+		if strings.EqualFold(status.Name, name) {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown status: fix the jira closed.statuses list")
+}
+
+func checkBoard(jiraClient *jira.Client, boardID int, key string) error {
+	if _, _, err := jiraClient.Board.GetBoard(boardID); err != nil {
+		return fmt.Errorf("%s: check the board id in the board URL", err)
+	}
+
+	req, err := jiraClient.NewRequest("GET", fmt.Sprintf("rest/agile/1.0/board/%d/project", boardID), nil)
+	if err != nil {
+		return err
+	}
+	result := new(boardProjects)
+	if resp, err := jiraClient.Do(req, result); err != nil {
+		return jira.NewJiraError(resp, err)
+	}
+
+	var keys []string
+	for _, p := range result.Values {
+		if key == "" || p.Key == key {
+			return nil
+		}
+		keys = append(keys, p.Key)
+	}
+	return fmt.Errorf("board only contains projects %s: check the board id in the board URL", strings.Join(keys, ", "))
+}
+
+func checkJql(jiraClient *jira.Client, jql string) error {
+	req, err := jiraClient.NewRequest("GET", fmt.Sprintf("rest/api/2/search?jql=%s&maxResults=0&validateQuery=strict", url.QueryEscape(jql)), nil)
+	if err != nil {
+		return err
+	}
+	result := new(searchResult)
+	if resp, err := jiraClient.Do(req, result); err != nil {
+		return fmt.Errorf("%s: fix the jql_filter", jira.NewJiraError(resp, err))
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package runner
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ovh/jerem/src/core"
+)
+
+func TestValidateConfig(t *testing.T) {
+	assert := require.New(t)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/rest/api/2/field", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[{"id": "customfield_10006", "name": "Story Points"}]`))
+	})
+	mux.HandleFunc("/rest/api/2/status", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[{"name": "Done"}, {"name": "Closed"}]`))
+	})
+	mux.HandleFunc("/rest/api/2/project", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[{"key": "K8S", "name": "Kubernetes"}, {"key": "OB", "name": "Observability"}]`))
+	})
+	mux.HandleFunc("/rest/agile/1.0/board/1", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"id": 1, "name": "K8S board"}`))
+	})
+	mux.HandleFunc("/rest/agile/1.0/board/1/project", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"values": [{"key": "K8S"}]}`))
+	})
+	mux.HandleFunc("/rest/agile/1.0/board/2", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	mux.HandleFunc("/rest/api/2/search", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("jql") != "project = \"K8S\" AND (component = test)" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(`{"total": 0}`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	fields := core.Fields{StoryPoint: core.DefaultStoryPointField, Impediment: core.DefaultImpedimentField}
+	reports, err := ValidateConfig(core.Config{
+		Jira: core.Jira{Auth: core.Auth{Type: core.AuthBasic}, URL: server.URL, ClosedStatuses: []string{"Done", "Resolved"}, Fields: fields},
+		Projects: []core.Project{
+			{Name: "K8S", Label: "K8S", Board: 1, Jql: "AND (component = test)", Fields: fields},
+			{Name: "OB", Label: "OB", Board: 1, Jql: "AND (component = )", Fields: fields},
+			{Name: "Observability", Label: "OBS", Board: 2, Fields: fields},
+			{Name: "UNKNOWN", Label: "UNKNOWN", Board: 1, Fields: core.Fields{StoryPoint: "story points", Impediment: "Unknown"}},
+		},
+	})
+	assert.NoError(err)
+	assert.Len(reports, 5)
+
+	// Jira: impediment field and Resolved status are missing
+	assert.True(reports[0].Failed())
+	assert.NoError(reports[0].Checks[0].Err)
+	assert.Error(reports[0].Checks[1].Err)
+	assert.NoError(reports[0].Checks[2].Err)
+	assert.Error(reports[0].Checks[3].Err)
+
+	assert.False(reports[1].Failed())
+
+	// OB: board 1 belongs to K8S and the jql filter is invalid
+	assert.NoError(reports[2].Checks[0].Err)
+	assert.EqualError(reports[2].Checks[1].Err, "board only contains projects K8S: check the board id in the board URL")
+	assert.Error(reports[2].Checks[2].Err)
+
+	// Observability: project found by name, unknown board
+	assert.NoError(reports[3].Checks[0].Err)
+	assert.Error(reports[3].Checks[1].Err)
+
+	// UNKNOWN: project doesn't exist, story point field found by name
+	assert.Error(reports[4].Checks[0].Err)
+	assert.NoError(reports[4].Checks[2].Err)
+	assert.Error(reports[4].Checks[3].Err)
+}
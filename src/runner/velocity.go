@@ -0,0 +1,245 @@
+package runner
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	warp "github.com/PierreZ/Warp10Exporter"
+	jira "github.com/andygrunwald/go-jira"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/ovh/jerem/src/core"
+)
+
+// sprintVelocity is the story points committed at a sprint start and
+// completed at its end
+type sprintVelocity struct {
+	End       time.Time
+	Committed float64
+	Completed float64
+}
+
+// Closed sprints don't change, their velocity is only computed once. The
+// cache of a project only keeps the sprints of its velocity window
+var velocityCache = struct {
+	sync.Mutex
+	projects map[string]map[int]sprintVelocity
+}{projects: make(map[string]map[int]sprintVelocity)}
+
+// Closed sprints of a board, they only change when an active sprint is
+// closed. They are listed again when the board active sprints change
+var closedSprintsCache = struct {
+	sync.Mutex
+	boards map[int]closedSprints
+}{boards: make(map[int]closedSprints)}
+
+type closedSprints struct {
+	Active  string
+	Sprints []jira.Sprint
+}
+
+// processVelocity walk the last closed sprints of the project board and
+// register their committed and completed story points, stamped at the sprint
+// end date, with the rolling average velocity and predictability
+func processVelocity(jiraClient *jira.Client, project core.Project, config core.Velocity, categories map[string]string, active []jira.Sprint, batch *warp.Batch) error {
+	if config.Sprints == 0 {
+		return nil
+	}
+
+	sprints, err := getCachedClosedSprints(jiraClient, project.Board, active)
+	if err != nil {
+		log.WithField("project", project.Name).WithError(err).Warn("Fail to get closed sprints")
+		return err
+	}
+	if len(sprints) > config.Sprints {
+		sprints = sprints[len(sprints)-config.Sprints:]
+	}
+
+	key := fmt.Sprintf("%s|%s|%s|%d", project.Name, project.Jql, project.Fields.StoryPoint, project.Board)
+
+	velocityCache.Lock()
+	cached := velocityCache.projects[key]
+	velocityCache.Unlock()
+
+	window := make(map[int]sprintVelocity, len(sprints))
+	var velocities []sprintVelocity
+	for _, sprint := range sprints {
+		velocity, ok := cached[sprint.ID]
+		if !ok {
+			issues, err := getSprintChangelogIssues(jiraClient, project, sprint.ID)
+			if err != nil {
+				log.WithFields(log.Fields{"sprint": sprint.Name, "project": project.Label}).
+					WithError(err).Warn("Fail to get closed sprint issues")
+				return err
+			}
+			velocity = computeSprintVelocity(issues, sprint, categories, project.Fields.StoryPoint)
+		}
+		window[sprint.ID] = velocity
+		velocities = append(velocities, velocity)
+	}
+
+	velocityCache.Lock()
+	velocityCache.projects[key] = window
+	velocityCache.Unlock()
+
+	registerVelocity(batch, velocities, config.Average, project.Label)
+	return nil
+}
+
+// getCachedClosedSprints return the closed sprints of a board, listed again
+// only when its active sprints changed since the last call
+func getCachedClosedSprints(jiraClient *jira.Client, boardID int, active []jira.Sprint) ([]jira.Sprint, error) {
+	ids := make([]string, 0, len(active))
+	for _, sprint := range active {
+		ids = append(ids, fmt.Sprintf("%d", sprint.ID))
+	}
+	sort.Strings(ids)
+	activeKey := strings.Join(ids, ",")
+
+	closedSprintsCache.Lock()
+	cached, ok := closedSprintsCache.boards[boardID]
+	closedSprintsCache.Unlock()
+	if ok && cached.Active == activeKey {
+		return cached.Sprints, nil
+	}
+
+	sprints, err := getClosedSprints(jiraClient, boardID)
+	if err != nil {
+		return nil, err
+	}
+
+	closedSprintsCache.Lock()
+	closedSprintsCache.boards[boardID] = closedSprints{Active: activeKey, Sprints: sprints}
+	closedSprintsCache.Unlock()
+	return sprints, nil
+}
+
+// getClosedSprints list the closed sprints of a board sorted by end date,
+// sprints shared from another board are ignored
+func getClosedSprints(jiraClient *jira.Client, boardID int) ([]jira.Sprint, error) {
+	var sprints []jira.Sprint
+	options := &jira.GetAllSprintsOptions{State: "closed"}
+	for {
+		result, _, err := jiraClient.Board.GetAllSprintsWithOptions(boardID, options)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, sprint := range result.Values {
+			if sprint.StartDate == nil || getSprintEnd(sprint) == nil {
+				continue
+			}
+			if sprint.OriginBoardID != 0 && sprint.OriginBoardID != boardID {
+				continue
+			}
+			sprints = append(sprints, sprint)
+		}
+
+		if result.IsLast || len(result.Values) == 0 {
+			break
+		}
+		options.StartAt = result.StartAt + len(result.Values)
+	}
+
+	sort.SliceStable(sprints, func(i, j int) bool {
+		return getSprintEnd(sprints[i]).Before(*getSprintEnd(sprints[j]))
+	})
+	return sprints, nil
+}
+
+// getSprintEnd return the date a sprint was completed, or its planned end
+func getSprintEnd(sprint jira.Sprint) *time.Time {
+	if sprint.CompleteDate != nil {
+		return sprint.CompleteDate
+	}
+	return sprint.EndDate
+}
+
+func getSprintChangelogIssues(jiraClient *jira.Client, project core.Project, sprintID int) ([]jira.Issue, error) {
+	var issues []jira.Issue
+	err := jiraClient.Issue.SearchPages(fmt.Sprintf("(project = \"%s\" %s) AND sprint = %d", project.Name, project.Jql, sprintID), &jira.SearchOptions{
+		Fields: []string{"id", "key", "created", "status", project.Fields.StoryPoint},
+		Expand: "changelog",
+	}, func(issue jira.Issue) error {
+		issues = append(issues, issue)
+		return nil
+	})
+	return issues, err
+}
+
+// computeSprintVelocity sum the story points of the issues in the sprint at
+// its start, and of the issues done at its end. Story points are read at
+// their current value
+func computeSprintVelocity(issues []jira.Issue, sprint jira.Sprint, categories map[string]string, storyPointField string) sprintVelocity {
+	end := *getSprintEnd(sprint)
+	velocity := sprintVelocity{End: end}
+
+	for _, issue := range issues {
+		sp, err := getStoryPoints(storyPointField, issue)
+		if err != nil {
+			log.WithField("key", issue.Key).WithError(err).Warn("Fail to get story points")
+			continue
+		}
+
+		if isInSprintAt(issue, getSprintChanges(issue, sprint.ID), true, *sprint.StartDate) {
+			velocity.Committed += sp
+		}
+
+		status := getStatusAt(issue, getStatusTransitions(issue), end)
+		if categories[strings.ToLower(status)] == "done" {
+			velocity.Completed += sp
+		}
+	}
+
+	return velocity
+}
+
+// registerVelocity register a datapoint per sprint, the average and
+// predictability are computed on the given number of sprints up to each
+// sprint
+func registerVelocity(batch *warp.Batch, velocities []sprintVelocity, average int, projectLabel string) {
+	if len(velocities) == 0 {
+		return
+	}
+
+	committed := getVelocityMetric("committed", projectLabel)
+	completed := getVelocityMetric("completed", projectLabel)
+	averageGTS := getVelocityMetric("average", projectLabel)
+	predictability := getVelocityMetric("predictability", projectLabel)
+
+	for i, velocity := range velocities {
+		committed.AddDatapoint(velocity.End, velocity.Committed)
+		completed.AddDatapoint(velocity.End, velocity.Completed)
+
+		first := i - average + 1
+		if first < 0 {
+			first = 0
+		}
+		var committedSum, completedSum float64
+		for _, v := range velocities[first : i+1] {
+			committedSum += v.Committed
+			completedSum += v.Completed
+		}
+
+		averageGTS.AddDatapoint(velocity.End, completedSum/float64(i+1-first))
+		if committedSum > 0 {
+			predictability.AddDatapoint(velocity.End, completedSum/committedSum)
+		}
+	}
+
+	batch.Register(committed)
+	batch.Register(completed)
+	batch.Register(averageGTS)
+	if len(predictability.Datapoints) > 0 {
+		batch.Register(predictability)
+	}
+}
+
+func getVelocityMetric(name, projectLabel string) *warp.GTS {
+	return warp.NewGTS(fmt.Sprintf("jerem.jira.velocity.%s", name)).WithLabels(warp.Labels{
+		"project": projectLabel,
+	})
+}
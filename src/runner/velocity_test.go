@@ -0,0 +1,202 @@
+package runner
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	warp "github.com/PierreZ/Warp10Exporter"
+	jira "github.com/andygrunwald/go-jira"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ovh/jerem/src/core"
+)
+
+func sprintFieldChange(created, from, to string) jira.ChangelogHistory {
+	return jira.ChangelogHistory{
+		Created: created,
+		Items:   []jira.ChangelogItems{{Field: "Sprint", From: from, To: to}},
+	}
+}
+
+func velocityIssue(created time.Time, storyPoints float64, histories ...jira.ChangelogHistory) jira.Issue {
+	return jira.Issue{
+		Fields: &jira.IssueFields{
+			Created:  jira.Time(created),
+			Status:   &jira.Status{Name: "To Do"},
+			Unknowns: map[string]interface{}{"customfield_10006": storyPoints},
+		},
+		Changelog: &jira.Changelog{Histories: histories},
+	}
+}
+
+func TestComputeSprintVelocity(t *testing.T) {
+	assert := require.New(t)
+
+	start := time.Date(2020, 1, 6, 9, 0, 0, 0, time.UTC)
+	end := time.Date(2020, 1, 17, 18, 0, 0, 0, time.UTC)
+	sprint := jira.Sprint{ID: 12, StartDate: &start, CompleteDate: &end}
+
+	created := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	issues := []jira.Issue{
+		// Committed and done
+		velocityIssue(created, 3,
+			sprintFieldChange("2020-01-03T00:00:00.000+0000", "", "12"),
+			statusChange("2020-01-10T00:00:00.000+0000", "To Do", "Done"),
+		),
+		// Committed, done after the sprint end
+		velocityIssue(created, 5,
+			sprintFieldChange("2020-01-03T00:00:00.000+0000", "11", "11, 12"),
+			statusChange("2020-01-20T00:00:00.000+0000", "To Do", "Done"),
+		),
+		// Added during the sprint and done
+		velocityIssue(created, 2,
+			sprintFieldChange("2020-01-08T00:00:00.000+0000", "", "12"),
+			statusChange("2020-01-15T00:00:00.000+0000", "To Do", "Done"),
+		),
+		// Created in the sprint before its start
+		velocityIssue(created, 8),
+	}
+
+	velocity := computeSprintVelocity(issues, sprint, flowCategories, "customfield_10006")
+	assert.Equal(sprintVelocity{End: end, Committed: 16, Completed: 5}, velocity)
+}
+
+func TestRegisterVelocity(t *testing.T) {
+	assert := require.New(t)
+
+	day := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	velocities := []sprintVelocity{
+		{End: day, Committed: 10, Completed: 8},
+		{End: day.AddDate(0, 0, 14), Committed: 10, Completed: 10},
+		{End: day.AddDate(0, 0, 28), Committed: 20, Completed: 12},
+	}
+
+	batch := warp.NewBatch()
+	registerVelocity(batch, velocities, 2, "K8S")
+
+	average := (*batch)[getVelocityMetric("average", "K8S").GetIdentifier()]
+	assert.Equal([]interface{}{8.0, 9.0, 11.0}, datapointValues(average))
+
+	predictability := (*batch)[getVelocityMetric("predictability", "K8S").GetIdentifier()]
+	assert.Equal([]interface{}{0.8, 0.9, 22.0 / 30.0}, datapointValues(predictability))
+}
+
+func TestGetClosedSprints(t *testing.T) {
+	assert := require.New(t)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/rest/agile/1.0/board/1/sprint", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("startAt") == "" {
+			w.Write([]byte(`{"startAt": 0, "isLast": false, "values": [
+				{"id": 2, "originBoardId": 1, "startDate": "2020-01-15T00:00:00.000Z", "completeDate": "2020-01-29T00:00:00.000Z"},
+				{"id": 3, "originBoardId": 2, "startDate": "2020-01-15T00:00:00.000Z", "completeDate": "2020-01-29T00:00:00.000Z"}
+			]}`))
+			return
+		}
+		w.Write([]byte(`{"startAt": 2, "isLast": true, "values": [
+			{"id": 1, "originBoardId": 1, "startDate": "2020-01-01T00:00:00.000Z", "endDate": "2020-01-15T00:00:00.000Z"},
+			{"id": 4, "originBoardId": 1}
+		]}`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	jiraClient, err := NewJiraClient(core.Jira{Auth: core.Auth{Type: core.AuthBasic}, URL: server.URL})
+	assert.NoError(err)
+
+	sprints, err := getClosedSprints(jiraClient, 1)
+	assert.NoError(err)
+	assert.Len(sprints, 2)
+	assert.Equal(1, sprints[0].ID)
+	assert.Equal(2, sprints[1].ID)
+}
+
+func datapointValues(gts *warp.GTS) []interface{} {
+	var values []interface{}
+	for _, dp := range gts.Datapoints {
+		values = append(values, dp.Value)
+	}
+	return values
+}
+
+func TestProcessVelocityCache(t *testing.T) {
+	assert := require.New(t)
+
+	var searches, listings int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/rest/agile/1.0/board/7/sprint", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&listings, 1)
+		w.Write([]byte(`{"startAt": 0, "isLast": true, "values": [
+			{"id": 1, "originBoardId": 7, "startDate": "2020-01-01T00:00:00.000Z", "completeDate": "2020-01-15T00:00:00.000Z"},
+			{"id": 2, "originBoardId": 7, "startDate": "2020-01-15T00:00:00.000Z", "completeDate": "2020-01-29T00:00:00.000Z"}
+		]}`))
+	})
+	mux.HandleFunc("/rest/api/2/search", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&searches, 1)
+		w.Write([]byte(`{"startAt": 0, "maxResults": 50, "total": 0, "issues": []}`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	jiraClient, err := NewJiraClient(core.Jira{Auth: core.Auth{Type: core.AuthBasic}, URL: server.URL})
+	assert.NoError(err)
+
+	project := core.Project{Name: "CACHE", Label: "CACHE", Board: 7}
+	config := core.Velocity{Sprints: 1, Average: 1}
+
+	// Closed sprints are kept between runs, start from none
+	velocityCache.Lock()
+	delete(velocityCache.projects, "CACHE|||7")
+	velocityCache.Unlock()
+	closedSprintsCache.Lock()
+	delete(closedSprintsCache.boards, 7)
+	closedSprintsCache.Unlock()
+	active := []jira.Sprint{{ID: 3}}
+
+	// Only the sprints of the window are kept in the cache
+	assert.NoError(processVelocity(jiraClient, project, config, flowCategories, active, warp.NewBatch()))
+	assert.Equal(int32(1), atomic.LoadInt32(&searches))
+
+	velocityCache.Lock()
+	cached := velocityCache.projects["CACHE|||7"]
+	velocityCache.Unlock()
+	assert.Len(cached, 1)
+	assert.Contains(cached, 2)
+
+	// Cached sprints are not requested again, nor listed while the active
+	// sprints don't change
+	assert.NoError(processVelocity(jiraClient, project, config, flowCategories, active, warp.NewBatch()))
+	assert.Equal(int32(1), atomic.LoadInt32(&searches))
+	assert.Equal(int32(1), atomic.LoadInt32(&listings))
+
+	// Closing the active sprint list the closed sprints again
+	assert.NoError(processVelocity(jiraClient, project, config, flowCategories, nil, warp.NewBatch()))
+	assert.Equal(int32(2), atomic.LoadInt32(&listings))
+}
+
+func TestStatusCategories(t *testing.T) {
+	assert := require.New(t)
+
+	var requests int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/rest/api/2/status", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	jiraClient, err := NewJiraClient(core.Jira{Auth: core.Auth{Type: core.AuthBasic}, URL: server.URL})
+	assert.NoError(err)
+
+	// Statuses are requested once, even on failure
+	categories := &statusCategories{jiraClient: jiraClient}
+	_, err = categories.get()
+	assert.Error(err)
+	_, err = categories.get()
+	assert.Error(err)
+	assert.Equal(int32(1), atomic.LoadInt32(&requests))
+}